@@ -0,0 +1,29 @@
+package e2e
+
+import (
+    "github.com/onsi/ginkgo"
+    "github.com/onsi/gomega"
+    "github.com/zryfish/framework/framework"
+    "github.com/zryfish/framework/framework/csimock"
+)
+
+var _ = ginkgo.Describe("CSI mock driver [Feature:CSI]", func() {
+    f := framework.NewDefaultFramework("csi-mock")
+
+    ginkgo.It("should provision and publish a volume", func() {
+        driver, err := csimock.Deploy(f, csimock.Options{})
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        f.AddPodSpecMutator(driver.ScheduleOnNode)
+
+        claim, err := f.CreateVolume(framework.VolumeOptions{Name: "data", StorageClass: driver.StorageClassName})
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        tester, err := f.NewVolumeTester(claim.Name)
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        gomega.Expect(tester.WriteFile("data", 1024)).To(gomega.Succeed())
+        gomega.Expect(tester.Verify()).To(gomega.Succeed())
+
+        _, err = driver.WaitForCalls("NodePublishVolume", 1)
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        gomega.Expect(driver.ExpectCallSequence("CreateVolume", "NodeStageVolume", "NodePublishVolume")).To(gomega.Succeed())
+    })
+})
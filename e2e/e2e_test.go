@@ -1,28 +1,98 @@
 package e2e
 
 import (
-    "fmt"
     "github.com/golang/glog"
     "github.com/onsi/ginkgo"
     "github.com/onsi/ginkgo/config"
-    "github.com/onsi/ginkgo/reporters"
     "github.com/onsi/gomega"
     "github.com/zryfish/framework/framework"
+    "github.com/zryfish/framework/framework/ginkgowrapper"
+    "github.com/zryfish/framework/framework/junit"
+    e2elog "github.com/zryfish/framework/framework/log"
+    "github.com/zryfish/framework/framework/speclog"
+    "github.com/zryfish/framework/framework/timeline"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes"
     "os"
     "path/filepath"
     "testing"
+    "time"
 )
 
+// reportMergeTimeout is how long node 1 waits for the other nodes to write their reports and timelines.
+const reportMergeTimeout = 5 * time.Minute
+
 func init()  {
     framework.RegisterFlags()
 }
 
+// Set up the environment and pre-pull the images once, and share the run id of
+// node 1 with every node, so all namespaces and reports of a parallel run carry
+// the same e2e-run value. The run of the Serial specs held back from a parallel
+// run gets the run id of the parallel run, which set up the environment already.
+var _ = ginkgo.SynchronizedBeforeSuite(func() []byte {
+    if framework.TestContext.SerialChild {
+        return []byte(framework.RunId)
+    }
+    if err := framework.Provider().Setup(); err != nil {
+        framework.Failf("Failed to set up provider %s: %v", framework.Provider().Name(), err)
+    }
+    config, err := framework.LoadConfig()
+    if err != nil {
+        framework.Failf("Failed to load client config: %v", err)
+    }
+    if err := framework.PrePullImages(kubernetes.NewForConfigOrDie(config)); err != nil {
+        framework.Logf("Failed to pre-pull images, specs may wait for image pulls: %v", err)
+    }
+    return []byte(framework.RunId)
+}, func(data []byte) {
+    framework.RunId = types.UID(data)
+})
+
+// Node 1 runs last, after every other node has finished its specs, so the
+// merge reporter only has to wait for them to flush their reports. The
+// Serial specs held back from a parallel run are run then.
+var _ = ginkgo.SynchronizedAfterSuite(func() {
+    // ginkgo runs the AfterSuite when interrupted, before exiting
+    framework.CleanupActiveNamespaces()
+}, func() {
+    if framework.TestContext.SerialChild {
+        // the parallel run tears down the environment
+        return
+    }
+    serialErr := framework.RunSerialSpecs()
+    if err := framework.Provider().Teardown(); err != nil {
+        framework.Failf("Failed to tear down provider %s: %v", framework.Provider().Name(), err)
+    }
+    if serialErr != nil {
+        framework.Failf("%v", serialErr)
+    }
+})
+
 func TestE2E(t *testing.T) {
     RunE2ETests(t)
 }
 
+// quarantineT keeps the go test from failing when the only failed specs are quarantined.
+type quarantineT struct {
+    *testing.T
+    reporter *junit.Reporter
+}
+
+func (t quarantineT) Fail() {
+    if t.reporter.OnlyQuarantinedFailures() {
+        framework.Logf("Only quarantined specs failed, not failing the suite")
+        return
+    }
+    t.T.Fail()
+}
+
 func RunE2ETests(t *testing.T) {
-    gomega.RegisterFailHandler(ginkgo.Fail)
+    gomega.RegisterFailHandler(ginkgowrapper.Fail)
+
+    if err := framework.AfterReadingAllFlags(&framework.TestContext); err != nil {
+        glog.Fatalf("Failed to load test context: %v", err)
+    }
 
     var r[] ginkgo.Reporter
 
@@ -33,11 +103,32 @@ func RunE2ETests(t *testing.T) {
     }
 
     if err := os.Mkdir(ReportDir, os.ModePerm); err != nil && !os.IsExist(err) {
-        glog.Fatal("Failed to create report directory %s", ReportDir)
+        glog.Fatalf("Failed to create report directory %s", ReportDir)
     }
+    framework.TestContext.ReportDir = ReportDir
 
-    r = append(r, reporters.NewJUnitReporter(filepath.Join(ReportDir, fmt.Sprintf("service_%02d.xml", config.GinkgoConfig.ParallelNode))))
+    if err := e2elog.RedirectGlog(filepath.Join(ReportDir, "glog")); err != nil {
+        glog.Fatalf("Failed to redirect glog: %v", err)
+    }
+
+    // ginkgo re-runs failed specs, each attempt gets a fresh namespace
+    if attempts := framework.TestContext.SpecRetries + 1; attempts > config.GinkgoConfig.FlakeAttempts {
+        config.GinkgoConfig.FlakeAttempts = attempts
+    }
+
+    reporter := junit.NewReporter(junit.NodeReportFile(ReportDir, framework.TestContext.ReportPrefix, config.GinkgoConfig.ParallelNode), framework.ReportProperties)
+    reporter.SetQuarantine(framework.Quarantined)
+    r = append(r, reporter)
+    merger := junit.NewMergeReporter(ReportDir, framework.TestContext.ReportPrefix, reportMergeTimeout)
+    merger.Include(junit.MergedReportFile(ReportDir, framework.SerialReportPrefix()))
+    r = append(r, merger)
+    recorder := timeline.NewRecorder(ReportDir, framework.TestContext.ReportPrefix, framework.SpecArtifactsDir, reportMergeTimeout)
+    recorder.Include(timeline.NodeTimelineFile(ReportDir, framework.SerialReportPrefix(), 1))
+    r = append(r, recorder)
+    if framework.TestContext.SpecLogFiles {
+        r = append(r, speclog.NewWriter(framework.SpecLogFile))
+    }
 
     framework.Logf("Starting e2e run %q on ginkgo node %d \n", framework.RunId, config.GinkgoConfig.ParallelNode)
-    ginkgo.RunSpecsWithDefaultAndCustomReporters(t, "e2e test suite", r)
-}
\ No newline at end of file
+    ginkgo.RunSpecsWithDefaultAndCustomReporters(quarantineT{T: t, reporter: reporter}, "e2e test suite", r)
+}
@@ -4,6 +4,8 @@ import (
     "github.com/onsi/ginkgo"
     "github.com/onsi/gomega"
     "github.com/zryfish/framework/framework"
+    "github.com/zryfish/framework/framework/builders"
+    "github.com/zryfish/framework/framework/image"
 )
 
 var _ = ginkgo.Describe("nginx service", func() {
@@ -16,4 +18,13 @@ var _ = ginkgo.Describe("nginx service", func() {
     ginkgo.It("should not do", func() {
         gomega.Expect(f.Namespace.Name).To(gomega.ContainSubstring("e2e"))
     })
+
+    ginkgo.It("should serve", func() {
+        _, err := builders.NewPod("nginx").
+            WithImage(image.Get(image.Nginx)).
+            WithPort(80).
+            WithProbe(builders.HTTPGetProbe("/", 80)).
+            CreateAndWait(f)
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
+    })
 })
@@ -0,0 +1,362 @@
+package framework
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zryfish/framework/framework/image"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// availabilityRequestTimeout bounds the requests of the availability monitors.
+const availabilityRequestTimeout = time.Second
+
+// availabilitySilentIntervals is the number of intervals without results after
+// which a monitor is silent, its checks fail as the service wasn't observed.
+const availabilitySilentIntervals = 5
+
+// AvailabilityResult is the outcome of a request of an availability monitor.
+type AvailabilityResult struct {
+	Time time.Time
+	// Err is nil for a successful request.
+	Err error
+}
+
+// AvailabilityMonitor sends requests in the background, e.g. to a service
+// during a rolling update or a node drain, and records their outcome. It is
+// stopped in AfterEach, or with Stop before checking the results.
+type AvailabilityMonitor struct {
+	name     string
+	interval time.Duration
+
+	lock    sync.Mutex
+	results []AvailabilityResult
+	// stopped is when the monitor was stopped, zero while it runs.
+	stopped time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func (f *Framework) newAvailabilityMonitor(name string, interval time.Duration) *AvailabilityMonitor {
+	m := &AvailabilityMonitor{
+		name:     name,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	f.lock.Lock()
+	f.monitors = append(f.monitors, m)
+	f.lock.Unlock()
+	return m
+}
+
+// MonitorAvailability runs request every interval, from the test process,
+// until the monitor is stopped.
+func (f *Framework) MonitorAvailability(name string, interval time.Duration, request func() error) *AvailabilityMonitor {
+	m := f.newAvailabilityMonitor(name, interval)
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.record(time.Now(), request())
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	Logf("Monitoring the availability of %s every %v", name, interval)
+	return m
+}
+
+// MonitorServiceThroughPortForward monitors a port of a service of the
+// framework namespace from the test process, through a port forward. Requests
+// are HTTP GETs of path, failing on 5xx codes, or TCP connections if path is
+// empty. Reconnections of the port forward count as downtime.
+func (f *Framework) MonitorServiceThroughPortForward(serviceName string, port int, path string, interval time.Duration) (*AvailabilityMonitor, error) {
+	pf, err := f.PortForwardToService(serviceName, port)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: availabilityRequestTimeout}
+	return f.MonitorAvailability(fmt.Sprintf("service %s port %d", serviceName, port), interval, func() error {
+		if path == "" {
+			conn, err := net.DialTimeout("tcp", pf.Addr, availabilityRequestTimeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+		resp, err := client.Get("http://" + pf.Addr + path)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}), nil
+}
+
+// MonitorServiceFromPod monitors a TCP port of a service of the framework
+// namespace from inside the cluster: a pod connects to the cluster IP of the
+// service every interval, and the outcomes are read from its logs. When the
+// logs can't be followed, e.g. the pod was evicted, failures are recorded
+// every interval until they can be again.
+func (f *Framework) MonitorServiceFromPod(serviceName string, port int32, interval time.Duration) (*AvailabilityMonitor, error) {
+	namespace := f.Namespace.Name
+	client := f.ClientSet
+	service, err := client.CoreV1().Services(namespace).Get(serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting service %s/%s: %v", namespace, serviceName, err)
+	}
+	address := net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port)))
+
+	script := fmt.Sprintf("while true; do if /agnhost connect --timeout=%v %s >/dev/null 2>&1; then echo ok; else echo failed; fi; sleep %.3f; done",
+		availabilityRequestTimeout, address, interval.Seconds())
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "availability-" + serviceName + "-"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:    probeContainer,
+				Image:   image.Get(image.Agnhost),
+				Command: []string{"/bin/sh", "-c", script},
+			}},
+		},
+	}
+	f.MutatePodSpec(&pod.Spec)
+	pod, err = client.CoreV1().Pods(namespace).Create(pod)
+	if err != nil {
+		return nil, fmt.Errorf("error creating availability probe pod for service %s/%s: %v", namespace, serviceName, err)
+	}
+	podName := pod.Name
+	if _, err := f.WaitForPodRunning(podName); err != nil {
+		return nil, err
+	}
+	follow := func(since time.Time) (io.ReadCloser, error) {
+		options := &v1.PodLogOptions{
+			Container:  probeContainer,
+			Follow:     true,
+			Timestamps: true,
+		}
+		if !since.IsZero() {
+			options.SinceTime = &metav1.Time{Time: since}
+		}
+		return client.CoreV1().Pods(namespace).GetLogs(podName, options).Stream()
+	}
+	logs, err := follow(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("error following the logs of availability probe pod %s/%s: %v", namespace, podName, err)
+	}
+
+	m := f.newAvailabilityMonitor(fmt.Sprintf("service %s port %d", serviceName, port), interval)
+	go func() {
+		defer close(m.done)
+		var last time.Time
+		for {
+			// the probe is silent until its logs are followed again, that counts as downtime
+			for err := m.readProbeLogs(logs, &last); err != nil; logs, err = follow(last) {
+				select {
+				case <-m.stop:
+					return
+				default:
+				}
+				m.record(time.Now(), fmt.Errorf("availability probe pod %s/%s isn't reporting: %v", namespace, podName, err))
+				Logf("Failed to follow the logs of availability probe pod %s/%s, retrying in %v: %v", namespace, podName, interval, err)
+				select {
+				case <-m.stop:
+					return
+				case <-time.After(interval):
+				}
+			}
+		}
+	}()
+	Logf("Monitoring the availability of service %s/%s port %d from pod %s every %v", namespace, serviceName, port, podName, interval)
+	return m, nil
+}
+
+// readProbeLogs records the outcomes logged by a probe pod after last, until
+// the logs end or the monitor is stopped. last is the time of the latest
+// outcome, the logs followed again from that time repeat the outcomes of the
+// same second.
+func (m *AvailabilityMonitor) readProbeLogs(logs io.ReadCloser, last *time.Time) error {
+	ended := make(chan struct{})
+	defer close(ended)
+	go func() {
+		select {
+		case <-m.stop:
+			// ends the scan of the logs
+		case <-ended:
+		}
+		logs.Close()
+	}()
+
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil || !t.After(*last) {
+			continue
+		}
+		*last = t
+		if parts[1] == "ok" {
+			m.record(t, nil)
+		} else {
+			m.record(t, errors.New(parts[1]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("the logs ended")
+}
+
+func (m *AvailabilityMonitor) record(t time.Time, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.results = append(m.results, AvailabilityResult{Time: t, Err: err})
+}
+
+// Stop stops the requests and logs a summary of the results.
+func (m *AvailabilityMonitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+		<-m.done
+		m.lock.Lock()
+		m.stopped = time.Now()
+		m.lock.Unlock()
+		Logf("Availability of %s: %d requests, error rate %.3f%%, max downtime %v", m.name, len(m.Results()), m.ErrorRate()*100, m.MaxDowntime())
+	})
+}
+
+// Results returns the outcomes of the requests so far, by time.
+func (m *AvailabilityMonitor) Results() []AvailabilityResult {
+	m.lock.Lock()
+	results := append([]AvailabilityResult{}, m.results...)
+	m.lock.Unlock()
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	return results
+}
+
+// ErrorRate returns the fraction of failed requests.
+func (m *AvailabilityMonitor) ErrorRate() float64 {
+	results := m.Results()
+	if len(results) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(results))
+}
+
+// MaxDowntime returns the longest downtime, from the first of consecutive
+// failed requests to the next successful request, or to the last request if
+// the failures last until the monitor is stopped.
+func (m *AvailabilityMonitor) MaxDowntime() time.Duration {
+	var longest time.Duration
+	var start *AvailabilityResult
+	results := m.Results()
+	for i := range results {
+		r := &results[i]
+		switch {
+		case r.Err != nil && start == nil:
+			start = r
+		case r.Err == nil && start != nil:
+			if d := r.Time.Sub(start.Time); d > longest {
+				longest = d
+			}
+			start = nil
+		}
+	}
+	if start != nil {
+		if d := results[len(results)-1].Time.Sub(start.Time); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// silent returns an error if the monitor recorded no results, or none for
+// availabilitySilentIntervals intervals, e.g. its requests hang: the service
+// wasn't observed then, the checks can't pass.
+func (m *AvailabilityMonitor) silent() error {
+	results := m.Results()
+	if len(results) == 0 {
+		return fmt.Errorf("%s has no recorded requests", m.name)
+	}
+	m.lock.Lock()
+	end := m.stopped
+	m.lock.Unlock()
+	if end.IsZero() {
+		end = time.Now()
+	}
+	maxSilence := availabilitySilentIntervals*m.interval + availabilityRequestTimeout
+	previous := results[0].Time
+	for _, r := range append(results[1:], AvailabilityResult{Time: end}) {
+		if r.Time.Sub(previous) > maxSilence {
+			return fmt.Errorf("%s recorded no requests from %s to %s", m.name, previous.Format(time.StampMilli), r.Time.Format(time.StampMilli))
+		}
+		previous = r.Time
+	}
+	return nil
+}
+
+// ExpectMaxDowntime returns an error if the longest downtime exceeds max, or
+// the monitor was silent.
+func (m *AvailabilityMonitor) ExpectMaxDowntime(max time.Duration) error {
+	if err := m.silent(); err != nil {
+		return err
+	}
+	if d := m.MaxDowntime(); d > max {
+		return fmt.Errorf("%s was down for %v, more than %v: %s", m.name, d, max, m.failures())
+	}
+	return nil
+}
+
+// ExpectMaxErrorRate returns an error if the fraction of failed requests exceeds max, e.g. 0.001 for 0.1%,
+// or the monitor was silent.
+func (m *AvailabilityMonitor) ExpectMaxErrorRate(max float64) error {
+	if err := m.silent(); err != nil {
+		return err
+	}
+	if rate := m.ErrorRate(); rate > max {
+		return fmt.Errorf("%s error rate is %.3f%%, more than %.3f%%: %s", m.name, rate*100, max*100, m.failures())
+	}
+	return nil
+}
+
+// maxReportedFailures limits the failures listed in the errors of the assertions.
+const maxReportedFailures = 10
+
+// failures describes the first failed requests.
+func (m *AvailabilityMonitor) failures() string {
+	var failures []string
+	for _, r := range m.Results() {
+		if r.Err != nil && len(failures) < maxReportedFailures {
+			failures = append(failures, fmt.Sprintf("%s %v", r.Time.Format(time.StampMilli), r.Err))
+		}
+	}
+	return strings.Join(failures, ", ")
+}
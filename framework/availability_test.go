@@ -0,0 +1,89 @@
+package framework
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAvailabilityMonitorChecks(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	failed := errors.New("failed")
+	// results every second, failures at the given seconds
+	results := func(n int, failures ...int) []AvailabilityResult {
+		var results []AvailabilityResult
+		for i := 0; i < n; i++ {
+			r := AvailabilityResult{Time: start.Add(time.Duration(i) * time.Second)}
+			for _, f := range failures {
+				if f == i {
+					r.Err = failed
+				}
+			}
+			results = append(results, r)
+		}
+		return results
+	}
+	tests := []struct {
+		name     string
+		results  []AvailabilityResult
+		stopped  time.Time
+		downtime time.Duration
+		rate     float64
+		err      string
+	}{
+		{
+			name:    "no failures",
+			results: results(10),
+			stopped: start.Add(10 * time.Second),
+		},
+		{
+			name:     "failures",
+			results:  results(10, 3, 4, 5, 8),
+			stopped:  start.Add(10 * time.Second),
+			downtime: 3 * time.Second,
+			rate:     0.4,
+		},
+		{
+			name:     "failures until stopped",
+			results:  results(10, 7, 8, 9),
+			stopped:  start.Add(10 * time.Second),
+			downtime: 2 * time.Second,
+			rate:     0.3,
+		},
+		{
+			name:    "no results",
+			stopped: start,
+			err:     "no recorded requests",
+		},
+		{
+			name:    "silent",
+			results: append(results(3), AvailabilityResult{Time: start.Add(20 * time.Second)}),
+			stopped: start.Add(21 * time.Second),
+			err:     "recorded no requests from",
+		},
+		{
+			name:    "silent until stopped",
+			results: results(3),
+			stopped: start.Add(time.Minute),
+			err:     "recorded no requests from",
+		},
+	}
+	for _, test := range tests {
+		m := &AvailabilityMonitor{name: "service", interval: time.Second, results: test.results, stopped: test.stopped}
+		if got := m.MaxDowntime(); got != test.downtime {
+			t.Errorf("%s: MaxDowntime() = %v, want %v", test.name, got, test.downtime)
+		}
+		if got := m.ErrorRate(); got != test.rate {
+			t.Errorf("%s: ErrorRate() = %v, want %v", test.name, got, test.rate)
+		}
+		for _, err := range []error{m.ExpectMaxDowntime(time.Hour), m.ExpectMaxErrorRate(1)} {
+			if test.err == "" && err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("%s: error = %v, want an error containing %q", test.name, err, test.err)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package builders has fluent constructors of the objects specs create, e.g.
+//
+//	pod, err := builders.NewPod("web").
+//		WithImage(image).
+//		WithPort(80).
+//		WithProbe(builders.HTTPGetProbe("/", 80)).
+//		CreateAndWait(f)
+//
+// Namespaced objects default to the namespace of the framework, and all the
+// objects get the standard labels of the framework, with the run id. The pod
+// specs are mutated by the pod spec mutators of the framework.
+package builders
+
+import (
+	"github.com/zryfish/framework/framework"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AppLabel selects the pods of a workload built with the default selector, and
+// is the default selector of services of the same name.
+const AppLabel = "e2e-app"
+
+// prepare defaults the namespace of a namespaced object to the framework
+// namespace and adds the standard labels of the framework.
+func prepare(f *framework.Framework, meta *metav1.ObjectMeta, namespaced bool) {
+	if namespaced && meta.Namespace == "" {
+		meta.Namespace = f.Namespace.Name
+	}
+	meta.Labels = merge(f.StandardLabels(), meta.Labels)
+}
+
+// merge returns the union of the maps, the later maps overriding the former ones.
+func merge(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
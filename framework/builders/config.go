@@ -0,0 +1,131 @@
+package builders
+
+import (
+	"github.com/zryfish/framework/framework"
+	"github.com/zryfish/framework/framework/redact"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapBuilder builds a config map, see NewConfigMap.
+type ConfigMapBuilder struct {
+	configMap *v1.ConfigMap
+}
+
+// NewConfigMap returns a builder of an empty config map.
+func NewConfigMap(name string) *ConfigMapBuilder {
+	return &ConfigMapBuilder{configMap: &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *ConfigMapBuilder) WithNamespace(namespace string) *ConfigMapBuilder {
+	b.configMap.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels.
+func (b *ConfigMapBuilder) WithLabels(labels map[string]string) *ConfigMapBuilder {
+	b.configMap.Labels = merge(b.configMap.Labels, labels)
+	return b
+}
+
+// WithData adds a key.
+func (b *ConfigMapBuilder) WithData(key, value string) *ConfigMapBuilder {
+	if b.configMap.Data == nil {
+		b.configMap.Data = map[string]string{}
+	}
+	b.configMap.Data[key] = value
+	return b
+}
+
+// WithBinaryData adds a binary key.
+func (b *ConfigMapBuilder) WithBinaryData(key string, value []byte) *ConfigMapBuilder {
+	if b.configMap.BinaryData == nil {
+		b.configMap.BinaryData = map[string][]byte{}
+	}
+	b.configMap.BinaryData[key] = value
+	return b
+}
+
+// Build returns the config map, without the defaults of the framework.
+func (b *ConfigMapBuilder) Build() *v1.ConfigMap {
+	return b.configMap.DeepCopy()
+}
+
+// Create creates the config map.
+func (b *ConfigMapBuilder) Create(f *framework.Framework) (*v1.ConfigMap, error) {
+	configMap := b.Build()
+	prepare(f, &configMap.ObjectMeta, true)
+	return f.ClientSet.CoreV1().ConfigMaps(configMap.Namespace).Create(configMap)
+}
+
+// CreateAndWait creates the config map, it is usable once created.
+func (b *ConfigMapBuilder) CreateAndWait(f *framework.Framework) (*v1.ConfigMap, error) {
+	return b.Create(f)
+}
+
+// SecretBuilder builds a secret, see NewSecret.
+type SecretBuilder struct {
+	secret *v1.Secret
+}
+
+// NewSecret returns a builder of an empty opaque secret. The values of the
+// secret are redacted from the logs and reports.
+func NewSecret(name string) *SecretBuilder {
+	return &SecretBuilder{secret: &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Type:       v1.SecretTypeOpaque,
+	}}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *SecretBuilder) WithNamespace(namespace string) *SecretBuilder {
+	b.secret.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels.
+func (b *SecretBuilder) WithLabels(labels map[string]string) *SecretBuilder {
+	b.secret.Labels = merge(b.secret.Labels, labels)
+	return b
+}
+
+// WithType sets the type, e.g. kubernetes.io/tls.
+func (b *SecretBuilder) WithType(secretType v1.SecretType) *SecretBuilder {
+	b.secret.Type = secretType
+	return b
+}
+
+// WithData adds a key.
+func (b *SecretBuilder) WithData(key string, value []byte) *SecretBuilder {
+	if b.secret.Data == nil {
+		b.secret.Data = map[string][]byte{}
+	}
+	b.secret.Data[key] = value
+	redact.Register(string(value))
+	return b
+}
+
+// WithStringData adds a key with a string value.
+func (b *SecretBuilder) WithStringData(key, value string) *SecretBuilder {
+	return b.WithData(key, []byte(value))
+}
+
+// Build returns the secret, without the defaults of the framework.
+func (b *SecretBuilder) Build() *v1.Secret {
+	return b.secret.DeepCopy()
+}
+
+// Create creates the secret.
+func (b *SecretBuilder) Create(f *framework.Framework) (*v1.Secret, error) {
+	secret := b.Build()
+	prepare(f, &secret.ObjectMeta, true)
+	return f.ClientSet.CoreV1().Secrets(secret.Namespace).Create(secret)
+}
+
+// CreateAndWait creates the secret, it is usable once created.
+func (b *SecretBuilder) CreateAndWait(f *framework.Framework) (*v1.Secret, error) {
+	return b.Create(f)
+}
@@ -0,0 +1,207 @@
+package builders
+
+import (
+	"github.com/zryfish/framework/framework"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// PodBuilder builds a pod, or the pod template of a workload. The container
+// methods apply to the main container, named after the pod.
+type PodBuilder struct {
+	pod *v1.Pod
+}
+
+// NewPod returns a builder of a pod with a main container named name.
+func NewPod(name string) *PodBuilder {
+	return &PodBuilder{pod: &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: name}},
+		},
+	}}
+}
+
+func (b *PodBuilder) main() *v1.Container {
+	return &b.pod.Spec.Containers[0]
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *PodBuilder) WithNamespace(namespace string) *PodBuilder {
+	b.pod.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels.
+func (b *PodBuilder) WithLabels(labels map[string]string) *PodBuilder {
+	b.pod.Labels = merge(b.pod.Labels, labels)
+	return b
+}
+
+// WithAnnotations adds annotations.
+func (b *PodBuilder) WithAnnotations(annotations map[string]string) *PodBuilder {
+	b.pod.Annotations = merge(b.pod.Annotations, annotations)
+	return b
+}
+
+// WithImage sets the image of the main container.
+func (b *PodBuilder) WithImage(image string) *PodBuilder {
+	b.main().Image = image
+	return b
+}
+
+// WithCommand sets the command of the main container.
+func (b *PodBuilder) WithCommand(command ...string) *PodBuilder {
+	b.main().Command = command
+	return b
+}
+
+// WithArgs sets the arguments of the main container.
+func (b *PodBuilder) WithArgs(args ...string) *PodBuilder {
+	b.main().Args = args
+	return b
+}
+
+// WithEnv adds an environment variable to the main container.
+func (b *PodBuilder) WithEnv(name, value string) *PodBuilder {
+	b.main().Env = append(b.main().Env, v1.EnvVar{Name: name, Value: value})
+	return b
+}
+
+// WithPort adds a TCP port to the main container.
+func (b *PodBuilder) WithPort(port int32) *PodBuilder {
+	return b.WithProtocolPort(port, v1.ProtocolTCP)
+}
+
+// WithProtocolPort adds a port to the main container.
+func (b *PodBuilder) WithProtocolPort(port int32, protocol v1.Protocol) *PodBuilder {
+	b.main().Ports = append(b.main().Ports, v1.ContainerPort{ContainerPort: port, Protocol: protocol})
+	return b
+}
+
+// WithProbe sets the readiness probe of the main container.
+func (b *PodBuilder) WithProbe(probe *v1.Probe) *PodBuilder {
+	b.main().ReadinessProbe = probe
+	return b
+}
+
+// WithLivenessProbe sets the liveness probe of the main container.
+func (b *PodBuilder) WithLivenessProbe(probe *v1.Probe) *PodBuilder {
+	b.main().LivenessProbe = probe
+	return b
+}
+
+// WithResources sets the requests of the main container, and the same limits,
+// e.g. WithResources("100m", "64Mi").
+func (b *PodBuilder) WithResources(cpu, memory string) *PodBuilder {
+	resources := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse(cpu),
+		v1.ResourceMemory: resource.MustParse(memory),
+	}
+	b.main().Resources = v1.ResourceRequirements{Requests: resources, Limits: resources}
+	return b
+}
+
+// WithVolume adds a volume mounted at mountPath in the main container.
+func (b *PodBuilder) WithVolume(volume v1.Volume, mountPath string) *PodBuilder {
+	b.pod.Spec.Volumes = append(b.pod.Spec.Volumes, volume)
+	b.main().VolumeMounts = append(b.main().VolumeMounts, v1.VolumeMount{Name: volume.Name, MountPath: mountPath})
+	return b
+}
+
+// WithContainer adds a container next to the main container.
+func (b *PodBuilder) WithContainer(container v1.Container) *PodBuilder {
+	b.pod.Spec.Containers = append(b.pod.Spec.Containers, container)
+	return b
+}
+
+// WithNodeName places the pod on a node.
+func (b *PodBuilder) WithNodeName(nodeName string) *PodBuilder {
+	b.pod.Spec.NodeName = nodeName
+	return b
+}
+
+// WithNodeSelector adds a node selector.
+func (b *PodBuilder) WithNodeSelector(selector map[string]string) *PodBuilder {
+	b.pod.Spec.NodeSelector = merge(b.pod.Spec.NodeSelector, selector)
+	return b
+}
+
+// WithServiceAccount sets the service account.
+func (b *PodBuilder) WithServiceAccount(name string) *PodBuilder {
+	b.pod.Spec.ServiceAccountName = name
+	return b
+}
+
+// WithRestartPolicy sets the restart policy.
+func (b *PodBuilder) WithRestartPolicy(policy v1.RestartPolicy) *PodBuilder {
+	b.pod.Spec.RestartPolicy = policy
+	return b
+}
+
+// Build returns the pod, without the defaults of the framework.
+func (b *PodBuilder) Build() *v1.Pod {
+	return b.pod.DeepCopy()
+}
+
+// template returns the pod template of a workload, with the given labels and
+// the labels selecting its pods.
+func (b *PodBuilder) template(labels, selector map[string]string) v1.PodTemplateSpec {
+	pod := b.Build()
+	return v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      merge(labels, pod.Labels, selector),
+			Annotations: pod.Annotations,
+		},
+		Spec: pod.Spec,
+	}
+}
+
+// Create creates the pod.
+func (b *PodBuilder) Create(f *framework.Framework) (*v1.Pod, error) {
+	pod := b.Build()
+	prepare(f, &pod.ObjectMeta, true)
+	f.MutatePodSpec(&pod.Spec)
+	return f.ClientSet.CoreV1().Pods(pod.Namespace).Create(pod)
+}
+
+// CreateAndWait creates the pod and waits for it to be running and ready.
+func (b *PodBuilder) CreateAndWait(f *framework.Framework) (*v1.Pod, error) {
+	pod, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	return f.WaitForPodRunningInNamespace(pod.Namespace, pod.Name)
+}
+
+// HTTPGetProbe returns a probe getting a path on a port.
+func HTTPGetProbe(path string, port int) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			HTTPGet: &v1.HTTPGetAction{Path: path, Port: intstr.FromInt(port)},
+		},
+		PeriodSeconds: 1,
+	}
+}
+
+// TCPProbe returns a probe connecting to a port.
+func TCPProbe(port int) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(port)},
+		},
+		PeriodSeconds: 1,
+	}
+}
+
+// ExecProbe returns a probe running a command.
+func ExecProbe(command ...string) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			Exec: &v1.ExecAction{Command: command},
+		},
+		PeriodSeconds: 1,
+	}
+}
@@ -0,0 +1,467 @@
+package builders
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zryfish/framework/framework"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceAccountBuilder builds a service account, see NewServiceAccount.
+type ServiceAccountBuilder struct {
+	serviceAccount *v1.ServiceAccount
+}
+
+// NewServiceAccount returns a builder of a service account.
+func NewServiceAccount(name string) *ServiceAccountBuilder {
+	return &ServiceAccountBuilder{serviceAccount: &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *ServiceAccountBuilder) WithNamespace(namespace string) *ServiceAccountBuilder {
+	b.serviceAccount.Namespace = namespace
+	return b
+}
+
+// Build returns the service account, without the defaults of the framework.
+func (b *ServiceAccountBuilder) Build() *v1.ServiceAccount {
+	return b.serviceAccount.DeepCopy()
+}
+
+// Create creates the service account.
+func (b *ServiceAccountBuilder) Create(f *framework.Framework) (*v1.ServiceAccount, error) {
+	serviceAccount := b.Build()
+	prepare(f, &serviceAccount.ObjectMeta, true)
+	return f.ClientSet.CoreV1().ServiceAccounts(serviceAccount.Namespace).Create(serviceAccount)
+}
+
+// CreateAndWait creates the service account and waits for its token secret,
+// pods using it are rejected until then.
+func (b *ServiceAccountBuilder) CreateAndWait(f *framework.Framework) (*v1.ServiceAccount, error) {
+	serviceAccount, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.WaitForServiceAccount(serviceAccount.Namespace, serviceAccount.Name); err != nil {
+		return nil, err
+	}
+	return serviceAccount, nil
+}
+
+// RoleBuilder builds a role, see NewRole.
+type RoleBuilder struct {
+	role *rbacv1.Role
+}
+
+// NewRole returns a builder of a role without rules.
+func NewRole(name string) *RoleBuilder {
+	return &RoleBuilder{role: &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *RoleBuilder) WithNamespace(namespace string) *RoleBuilder {
+	b.role.Namespace = namespace
+	return b
+}
+
+// WithRule adds a rule, "" is the core API group.
+func (b *RoleBuilder) WithRule(apiGroups, resources, verbs []string) *RoleBuilder {
+	b.role.Rules = append(b.role.Rules, rbacv1.PolicyRule{APIGroups: apiGroups, Resources: resources, Verbs: verbs})
+	return b
+}
+
+// Build returns the role, without the defaults of the framework.
+func (b *RoleBuilder) Build() *rbacv1.Role {
+	return b.role.DeepCopy()
+}
+
+// Create creates the role.
+func (b *RoleBuilder) Create(f *framework.Framework) (*rbacv1.Role, error) {
+	role := b.Build()
+	prepare(f, &role.ObjectMeta, true)
+	return f.ClientSet.RbacV1().Roles(role.Namespace).Create(role)
+}
+
+// CreateAndWait creates the role and waits for the authorizer to allow its
+// rules to the subjects of the role bindings already binding it. Bindings
+// created later wait with RoleBindingBuilder.CreateAndWait.
+func (b *RoleBuilder) CreateAndWait(f *framework.Framework) (*rbacv1.Role, error) {
+	role, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := f.ClientSet.RbacV1().RoleBindings(role.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the role bindings of namespace %s: %v", role.Namespace, err)
+	}
+	for _, binding := range bindings.Items {
+		if binding.RoleRef.Kind == "Role" && binding.RoleRef.Name == role.Name {
+			if err := waitForAccess(f, role.Namespace, binding.Subjects, role.Rules); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return role, nil
+}
+
+// ClusterRoleBuilder builds a cluster role, see NewClusterRole.
+type ClusterRoleBuilder struct {
+	role *rbacv1.ClusterRole
+}
+
+// NewClusterRole returns a builder of a cluster role without rules. Cluster
+// roles aren't deleted with the namespace, they are deleted in AfterEach, and
+// their names must be unique, e.g. prefixed with the framework namespace.
+func NewClusterRole(name string) *ClusterRoleBuilder {
+	return &ClusterRoleBuilder{role: &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}}
+}
+
+// WithRule adds a rule, "" is the core API group.
+func (b *ClusterRoleBuilder) WithRule(apiGroups, resources, verbs []string) *ClusterRoleBuilder {
+	b.role.Rules = append(b.role.Rules, rbacv1.PolicyRule{APIGroups: apiGroups, Resources: resources, Verbs: verbs})
+	return b
+}
+
+// Build returns the cluster role, without the defaults of the framework.
+func (b *ClusterRoleBuilder) Build() *rbacv1.ClusterRole {
+	return b.role.DeepCopy()
+}
+
+// Create creates the cluster role.
+func (b *ClusterRoleBuilder) Create(f *framework.Framework) (*rbacv1.ClusterRole, error) {
+	role := b.Build()
+	prepare(f, &role.ObjectMeta, false)
+	created, err := f.ClientSet.RbacV1().ClusterRoles().Create(role)
+	if err != nil {
+		return nil, err
+	}
+	f.AddCleanup(func() error {
+		return ignoreNotFound(f.ClientSet.RbacV1().ClusterRoles().Delete(created.Name, &metav1.DeleteOptions{}))
+	})
+	return created, nil
+}
+
+// CreateAndWait creates the cluster role and waits for the authorizer to allow
+// its rules to the subjects of the cluster role bindings already binding it.
+// Bindings created later wait with their CreateAndWait.
+func (b *ClusterRoleBuilder) CreateAndWait(f *framework.Framework) (*rbacv1.ClusterRole, error) {
+	role, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := f.ClientSet.RbacV1().ClusterRoleBindings().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the cluster role bindings: %v", err)
+	}
+	for _, binding := range bindings.Items {
+		if binding.RoleRef.Kind == "ClusterRole" && binding.RoleRef.Name == role.Name {
+			if err := waitForAccess(f, "", binding.Subjects, role.Rules); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return role, nil
+}
+
+// subjects are the subjects of a role binding or a cluster role binding.
+type subjects []rbacv1.Subject
+
+func (s *subjects) addServiceAccount(namespace, name string) {
+	*s = append(*s, rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: namespace, Name: name})
+}
+
+func (s *subjects) addUser(name string) {
+	*s = append(*s, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: name})
+}
+
+func (s *subjects) addGroup(name string) {
+	*s = append(*s, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.GroupKind, Name: name})
+}
+
+// in returns the subjects, the service accounts without namespace in namespace.
+func (s subjects) in(namespace string) []rbacv1.Subject {
+	in := append([]rbacv1.Subject{}, s...)
+	for i := range in {
+		if in[i].Kind == rbacv1.ServiceAccountKind && in[i].Namespace == "" {
+			in[i].Namespace = namespace
+		}
+	}
+	return in
+}
+
+// RoleBindingBuilder builds a role binding, see NewRoleBinding.
+type RoleBindingBuilder struct {
+	meta     metav1.ObjectMeta
+	roleRef  rbacv1.RoleRef
+	subjects subjects
+}
+
+// NewRoleBinding returns a builder of a role binding without subjects,
+// binding a role unless bound to a cluster role with WithClusterRole.
+func NewRoleBinding(name, roleName string) *RoleBindingBuilder {
+	return &RoleBindingBuilder{
+		meta:    metav1.ObjectMeta{Name: name},
+		roleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: roleName},
+	}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *RoleBindingBuilder) WithNamespace(namespace string) *RoleBindingBuilder {
+	b.meta.Namespace = namespace
+	return b
+}
+
+// WithClusterRole binds a cluster role in the namespace of the role binding.
+func (b *RoleBindingBuilder) WithClusterRole(clusterRoleName string) *RoleBindingBuilder {
+	b.roleRef.Kind = "ClusterRole"
+	b.roleRef.Name = clusterRoleName
+	return b
+}
+
+// WithServiceAccount adds a service account subject, of the namespace of the
+// role binding if namespace is empty.
+func (b *RoleBindingBuilder) WithServiceAccount(namespace, name string) *RoleBindingBuilder {
+	b.subjects.addServiceAccount(namespace, name)
+	return b
+}
+
+// WithUser adds a user subject.
+func (b *RoleBindingBuilder) WithUser(name string) *RoleBindingBuilder {
+	b.subjects.addUser(name)
+	return b
+}
+
+// WithGroup adds a group subject.
+func (b *RoleBindingBuilder) WithGroup(name string) *RoleBindingBuilder {
+	b.subjects.addGroup(name)
+	return b
+}
+
+// Build returns the role binding, without the defaults of the framework.
+func (b *RoleBindingBuilder) Build() *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{ObjectMeta: *b.meta.DeepCopy(), RoleRef: b.roleRef, Subjects: b.subjects.in(b.meta.Namespace)}
+}
+
+// Create creates the role binding.
+func (b *RoleBindingBuilder) Create(f *framework.Framework) (*rbacv1.RoleBinding, error) {
+	binding := b.Build()
+	prepare(f, &binding.ObjectMeta, true)
+	binding.Subjects = b.subjects.in(binding.Namespace)
+	return f.ClientSet.RbacV1().RoleBindings(binding.Namespace).Create(binding)
+}
+
+// CreateAndWait creates the role binding and waits for the authorizer to allow
+// the rules of its role to its subjects. The role must exist.
+func (b *RoleBindingBuilder) CreateAndWait(f *framework.Framework) (*rbacv1.RoleBinding, error) {
+	binding, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := boundRules(f, binding.Namespace, binding.RoleRef)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitForAccess(f, binding.Namespace, binding.Subjects, rules); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// ClusterRoleBindingBuilder builds a cluster role binding, see NewClusterRoleBinding.
+type ClusterRoleBindingBuilder struct {
+	meta     metav1.ObjectMeta
+	roleRef  rbacv1.RoleRef
+	subjects subjects
+}
+
+// NewClusterRoleBinding returns a builder of a cluster role binding without
+// subjects. Cluster role bindings aren't deleted with the namespace, they are
+// deleted in AfterEach, and their names must be unique.
+func NewClusterRoleBinding(name, clusterRoleName string) *ClusterRoleBindingBuilder {
+	return &ClusterRoleBindingBuilder{
+		meta:    metav1.ObjectMeta{Name: name},
+		roleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterRoleName},
+	}
+}
+
+// WithServiceAccount adds a service account subject, of the framework namespace if namespace is empty.
+func (b *ClusterRoleBindingBuilder) WithServiceAccount(namespace, name string) *ClusterRoleBindingBuilder {
+	b.subjects.addServiceAccount(namespace, name)
+	return b
+}
+
+// WithUser adds a user subject.
+func (b *ClusterRoleBindingBuilder) WithUser(name string) *ClusterRoleBindingBuilder {
+	b.subjects.addUser(name)
+	return b
+}
+
+// WithGroup adds a group subject.
+func (b *ClusterRoleBindingBuilder) WithGroup(name string) *ClusterRoleBindingBuilder {
+	b.subjects.addGroup(name)
+	return b
+}
+
+// Build returns the cluster role binding, without the defaults of the framework.
+func (b *ClusterRoleBindingBuilder) Build() *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{ObjectMeta: *b.meta.DeepCopy(), RoleRef: b.roleRef, Subjects: b.subjects.in("")}
+}
+
+// Create creates the cluster role binding.
+func (b *ClusterRoleBindingBuilder) Create(f *framework.Framework) (*rbacv1.ClusterRoleBinding, error) {
+	binding := b.Build()
+	binding.Subjects = b.subjects.in(f.Namespace.Name)
+	prepare(f, &binding.ObjectMeta, false)
+	created, err := f.ClientSet.RbacV1().ClusterRoleBindings().Create(binding)
+	if err != nil {
+		return nil, err
+	}
+	f.AddCleanup(func() error {
+		return ignoreNotFound(f.ClientSet.RbacV1().ClusterRoleBindings().Delete(created.Name, &metav1.DeleteOptions{}))
+	})
+	return created, nil
+}
+
+// CreateAndWait creates the cluster role binding and waits for the authorizer
+// to allow the rules of its cluster role to its subjects, in all namespaces.
+// The cluster role must exist.
+func (b *ClusterRoleBindingBuilder) CreateAndWait(f *framework.Framework) (*rbacv1.ClusterRoleBinding, error) {
+	binding, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := boundRules(f, "", binding.RoleRef)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitForAccess(f, "", binding.Subjects, rules); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// boundRules returns the rules of the role, or cluster role, of a binding of namespace.
+func boundRules(f *framework.Framework, namespace string, ref rbacv1.RoleRef) ([]rbacv1.PolicyRule, error) {
+	if ref.Kind == "Role" {
+		role, err := f.ClientSet.RbacV1().Roles(namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting role %s/%s: %v", namespace, ref.Name, err)
+		}
+		return role.Rules, nil
+	}
+	role, err := f.ClientSet.RbacV1().ClusterRoles().Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting cluster role %s: %v", ref.Name, err)
+	}
+	return role.Rules, nil
+}
+
+// waitForAccess polls subject access reviews until the authorizer allows the
+// rules to the subjects, in namespace, "" for all namespaces. A request
+// matching the first group, resource, name and verb of each rule is reviewed.
+func waitForAccess(f *framework.Framework, namespace string, subjects []rbacv1.Subject, rules []rbacv1.PolicyRule) error {
+	var reviews []authorizationv1.SubjectAccessReviewSpec
+	for _, subject := range subjects {
+		for _, rule := range rules {
+			reviews = append(reviews, accessReview(namespace, subject, rule))
+		}
+	}
+	var denied string
+	err := f.WaitUntil(f.Timeouts.RBACPropagation, func() (bool, error) {
+		for _, spec := range reviews {
+			review, err := f.ClientSet.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{Spec: spec})
+			if err != nil {
+				framework.Logf("Failed to review the access of %s, retrying in %v: %v", describeReview(spec), f.Timeouts.Poll, err)
+				return false, nil
+			}
+			if !review.Status.Allowed {
+				denied = describeReview(spec)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for the authorizer to allow %s: %v", denied, err)
+	}
+	return nil
+}
+
+// accessReview returns the review of a request of subject allowed by rule.
+func accessReview(namespace string, subject rbacv1.Subject, rule rbacv1.PolicyRule) authorizationv1.SubjectAccessReviewSpec {
+	var spec authorizationv1.SubjectAccessReviewSpec
+	switch subject.Kind {
+	case rbacv1.ServiceAccountKind:
+		spec.User = "system:serviceaccount:" + subject.Namespace + ":" + subject.Name
+		spec.Groups = []string{"system:serviceaccounts", "system:serviceaccounts:" + subject.Namespace}
+	case rbacv1.UserKind:
+		spec.User = subject.Name
+	case rbacv1.GroupKind:
+		spec.Groups = []string{subject.Name}
+	}
+	if len(rule.NonResourceURLs) > 0 {
+		spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: first(rule.NonResourceURLs), Verb: first(rule.Verbs)}
+		return spec
+	}
+	resource := strings.SplitN(first(rule.Resources), "/", 2)
+	spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      first(rule.Verbs),
+		Group:     first(rule.APIGroups),
+		Resource:  resource[0],
+		Name:      first(rule.ResourceNames),
+	}
+	if len(resource) == 2 {
+		spec.ResourceAttributes.Subresource = resource[1]
+	}
+	return spec
+}
+
+// describeReview describes the request of a review, e.g. "user alice to list pods".
+func describeReview(spec authorizationv1.SubjectAccessReviewSpec) string {
+	subject := "user " + spec.User
+	if spec.User == "" {
+		subject = "group " + strings.Join(spec.Groups, ", ")
+	}
+	if spec.NonResourceAttributes != nil {
+		return fmt.Sprintf("%s to %s %s", subject, spec.NonResourceAttributes.Verb, spec.NonResourceAttributes.Path)
+	}
+	a := spec.ResourceAttributes
+	resource := a.Resource
+	if a.Subresource != "" {
+		resource += "/" + a.Subresource
+	}
+	if a.Group != "" {
+		resource += "." + a.Group
+	}
+	if a.Namespace != "" {
+		resource += " in namespace " + a.Namespace
+	}
+	return fmt.Sprintf("%s to %s %s", subject, a.Verb, resource)
+}
+
+// first returns the first value, "" if there are none.
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func ignoreNotFound(err error) error {
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package builders
+
+import (
+	"reflect"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestAccessReview(t *testing.T) {
+	tests := []struct {
+		namespace string
+		subject   rbacv1.Subject
+		rule      rbacv1.PolicyRule
+		want      authorizationv1.SubjectAccessReviewSpec
+		describe  string
+	}{
+		{
+			namespace: "e2e",
+			subject:   rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "e2e", Name: "driver"},
+			rule:      rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods", "nodes"}, Verbs: []string{"get", "list"}},
+			want: authorizationv1.SubjectAccessReviewSpec{
+				User:               "system:serviceaccount:e2e:driver",
+				Groups:             []string{"system:serviceaccounts", "system:serviceaccounts:e2e"},
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Namespace: "e2e", Verb: "get", Resource: "pods"},
+			},
+			describe: "user system:serviceaccount:e2e:driver to get pods in namespace e2e",
+		},
+		{
+			subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: "alice"},
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"storage.k8s.io"}, Resources: []string{"volumeattachments/status"}, ResourceNames: []string{"va"}, Verbs: []string{"patch"}},
+			want: authorizationv1.SubjectAccessReviewSpec{
+				User:               "alice",
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "patch", Group: "storage.k8s.io", Resource: "volumeattachments", Subresource: "status", Name: "va"},
+			},
+			describe: "user alice to patch volumeattachments/status.storage.k8s.io",
+		},
+		{
+			subject: rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "admins"},
+			rule:    rbacv1.PolicyRule{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}},
+			want: authorizationv1.SubjectAccessReviewSpec{
+				Groups:                []string{"admins"},
+				NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: "/metrics", Verb: "get"},
+			},
+			describe: "group admins to get /metrics",
+		},
+	}
+	for _, test := range tests {
+		got := accessReview(test.namespace, test.subject, test.rule)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("accessReview(%q, %v, %v) = %+v, want %+v", test.namespace, test.subject, test.rule, got, test.want)
+		}
+		if describe := describeReview(got); describe != test.describe {
+			t.Errorf("describeReview(%+v) = %q, want %q", got, describe, test.describe)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package builders
+
+import (
+	"fmt"
+
+	"github.com/zryfish/framework/framework"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServiceBuilder builds a service, see NewService.
+type ServiceBuilder struct {
+	service *v1.Service
+}
+
+// NewService returns a builder of a cluster IP service selecting the pods with
+// the label AppLabel=name, the pods of the workloads of the same name.
+func NewService(name string) *ServiceBuilder {
+	return &ServiceBuilder{service: &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{AppLabel: name},
+		},
+	}}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *ServiceBuilder) WithNamespace(namespace string) *ServiceBuilder {
+	b.service.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels.
+func (b *ServiceBuilder) WithLabels(labels map[string]string) *ServiceBuilder {
+	b.service.Labels = merge(b.service.Labels, labels)
+	return b
+}
+
+// WithSelector replaces the selector of the pods.
+func (b *ServiceBuilder) WithSelector(selector map[string]string) *ServiceBuilder {
+	b.service.Spec.Selector = selector
+	return b
+}
+
+// WithPort adds a TCP port forwarded to the same port of the pods.
+func (b *ServiceBuilder) WithPort(port int32) *ServiceBuilder {
+	return b.WithTargetPort(port, int(port), v1.ProtocolTCP)
+}
+
+// WithTargetPort adds a port forwarded to a port of the pods.
+func (b *ServiceBuilder) WithTargetPort(port int32, targetPort int, protocol v1.Protocol) *ServiceBuilder {
+	b.service.Spec.Ports = append(b.service.Spec.Ports, v1.ServicePort{
+		Name:       fmt.Sprintf("%s-%d", protocolName(protocol), port),
+		Port:       port,
+		TargetPort: intstr.FromInt(targetPort),
+		Protocol:   protocol,
+	})
+	return b
+}
+
+// WithType sets the type, e.g. NodePort or LoadBalancer.
+func (b *ServiceBuilder) WithType(serviceType v1.ServiceType) *ServiceBuilder {
+	b.service.Spec.Type = serviceType
+	return b
+}
+
+// Headless makes the service headless, e.g. to govern a stateful set.
+func (b *ServiceBuilder) Headless() *ServiceBuilder {
+	b.service.Spec.ClusterIP = v1.ClusterIPNone
+	return b
+}
+
+// Build returns the service, without the defaults of the framework.
+func (b *ServiceBuilder) Build() *v1.Service {
+	return b.service.DeepCopy()
+}
+
+// Create creates the service.
+func (b *ServiceBuilder) Create(f *framework.Framework) (*v1.Service, error) {
+	service := b.Build()
+	prepare(f, &service.ObjectMeta, true)
+	return f.ClientSet.CoreV1().Services(service.Namespace).Create(service)
+}
+
+// CreateAndWait creates the service and waits for it to have a ready endpoint.
+func (b *ServiceBuilder) CreateAndWait(f *framework.Framework) (*v1.Service, error) {
+	service, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	err = f.WaitUntil(f.Timeouts.PodStart, func() (bool, error) {
+		endpoints, err := f.ClientSet.CoreV1().Endpoints(service.Namespace).Get(service.Name, metav1.GetOptions{})
+		if err != nil {
+			// the endpoints are created by a controller
+			return false, nil
+		}
+		for _, subset := range endpoints.Subsets {
+			if len(subset.Addresses) > 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return service, fmt.Errorf("error waiting for service %s/%s to have a ready endpoint: %v", service.Namespace, service.Name, err)
+	}
+	return service, nil
+}
+
+// protocolName returns the lower case name of a protocol, TCP by default.
+func protocolName(protocol v1.Protocol) string {
+	switch protocol {
+	case v1.ProtocolUDP:
+		return "udp"
+	case v1.ProtocolSCTP:
+		return "sctp"
+	}
+	return "tcp"
+}
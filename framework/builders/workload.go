@@ -0,0 +1,321 @@
+package builders
+
+import (
+	"fmt"
+
+	"github.com/zryfish/framework/framework"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeploymentBuilder builds a deployment, see NewDeployment.
+type DeploymentBuilder struct {
+	deployment *appsv1.Deployment
+	pod        *PodBuilder
+}
+
+// NewDeployment returns a builder of a deployment of one replica, selecting
+// its pods with the label AppLabel=name. The pods are built by NewPod(name)
+// unless set with WithPod.
+func NewDeployment(name string) *DeploymentBuilder {
+	replicas := int32(1)
+	return &DeploymentBuilder{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{AppLabel: name}},
+			},
+		},
+		pod: NewPod(name),
+	}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *DeploymentBuilder) WithNamespace(namespace string) *DeploymentBuilder {
+	b.deployment.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels to the deployment.
+func (b *DeploymentBuilder) WithLabels(labels map[string]string) *DeploymentBuilder {
+	b.deployment.Labels = merge(b.deployment.Labels, labels)
+	return b
+}
+
+// WithReplicas sets the number of replicas.
+func (b *DeploymentBuilder) WithReplicas(replicas int32) *DeploymentBuilder {
+	b.deployment.Spec.Replicas = &replicas
+	return b
+}
+
+// WithPod sets the builder of the pods.
+func (b *DeploymentBuilder) WithPod(pod *PodBuilder) *DeploymentBuilder {
+	b.pod = pod
+	return b
+}
+
+// WithStrategy sets the update strategy.
+func (b *DeploymentBuilder) WithStrategy(strategy appsv1.DeploymentStrategy) *DeploymentBuilder {
+	b.deployment.Spec.Strategy = strategy
+	return b
+}
+
+// Build returns the deployment, without the defaults of the framework.
+func (b *DeploymentBuilder) Build() *appsv1.Deployment {
+	deployment := b.deployment.DeepCopy()
+	deployment.Spec.Template = b.pod.template(nil, deployment.Spec.Selector.MatchLabels)
+	return deployment
+}
+
+// Create creates the deployment.
+func (b *DeploymentBuilder) Create(f *framework.Framework) (*appsv1.Deployment, error) {
+	deployment := b.deployment.DeepCopy()
+	deployment.Spec.Template = b.pod.template(f.StandardLabels(), deployment.Spec.Selector.MatchLabels)
+	prepare(f, &deployment.ObjectMeta, true)
+	f.MutatePodSpec(&deployment.Spec.Template.Spec)
+	return f.ClientSet.AppsV1().Deployments(deployment.Namespace).Create(deployment)
+}
+
+// CreateAndWait creates the deployment and waits for all its replicas to be
+// updated and ready.
+func (b *DeploymentBuilder) CreateAndWait(f *framework.Framework) (*appsv1.Deployment, error) {
+	deployment, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	return WaitForDeploymentReady(f, deployment.Namespace, deployment.Name)
+}
+
+// WaitForDeploymentReady waits for the replicas of a deployment to be updated
+// and ready, e.g. after a rolling update.
+func WaitForDeploymentReady(f *framework.Framework, namespace, name string) (*appsv1.Deployment, error) {
+	var deployment *appsv1.Deployment
+	err := f.WaitUntil(f.Timeouts.PodStart, func() (bool, error) {
+		var err error
+		deployment, err = f.ClientSet.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		replicas := *deployment.Spec.Replicas
+		status := deployment.Status
+		return status.ObservedGeneration >= deployment.Generation &&
+			status.UpdatedReplicas == replicas &&
+			status.ReadyReplicas == replicas &&
+			status.Replicas == replicas, nil
+	})
+	if err != nil {
+		return deployment, fmt.Errorf("error waiting for deployment %s/%s to be ready: %v", namespace, name, err)
+	}
+	return deployment, nil
+}
+
+// StatefulSetBuilder builds a stateful set, see NewStatefulSet.
+type StatefulSetBuilder struct {
+	statefulSet *appsv1.StatefulSet
+	pod         *PodBuilder
+	// claimMounts mount the volume claims in the main container of the pods.
+	claimMounts []v1.VolumeMount
+}
+
+// NewStatefulSet returns a builder of a stateful set of one replica, selecting
+// its pods with the label AppLabel=name, governed by the service name, e.g.
+// NewService(name).Headless(). The pods are built by NewPod(name) unless set
+// with WithPod.
+func NewStatefulSet(name string) *StatefulSetBuilder {
+	replicas := int32(1)
+	return &StatefulSetBuilder{
+		statefulSet: &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:    &replicas,
+				ServiceName: name,
+				Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{AppLabel: name}},
+			},
+		},
+		pod: NewPod(name),
+	}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *StatefulSetBuilder) WithNamespace(namespace string) *StatefulSetBuilder {
+	b.statefulSet.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels to the stateful set.
+func (b *StatefulSetBuilder) WithLabels(labels map[string]string) *StatefulSetBuilder {
+	b.statefulSet.Labels = merge(b.statefulSet.Labels, labels)
+	return b
+}
+
+// WithReplicas sets the number of replicas.
+func (b *StatefulSetBuilder) WithReplicas(replicas int32) *StatefulSetBuilder {
+	b.statefulSet.Spec.Replicas = &replicas
+	return b
+}
+
+// WithPod sets the builder of the pods.
+func (b *StatefulSetBuilder) WithPod(pod *PodBuilder) *StatefulSetBuilder {
+	b.pod = pod
+	return b
+}
+
+// WithVolumeClaim adds a volume claim template, mounted at mountPath in the
+// main container of the pods.
+func (b *StatefulSetBuilder) WithVolumeClaim(claim v1.PersistentVolumeClaim, mountPath string) *StatefulSetBuilder {
+	b.statefulSet.Spec.VolumeClaimTemplates = append(b.statefulSet.Spec.VolumeClaimTemplates, claim)
+	b.claimMounts = append(b.claimMounts, v1.VolumeMount{Name: claim.Name, MountPath: mountPath})
+	return b
+}
+
+// Build returns the stateful set, without the defaults of the framework.
+func (b *StatefulSetBuilder) Build() *appsv1.StatefulSet {
+	return b.build(nil)
+}
+
+func (b *StatefulSetBuilder) build(labels map[string]string) *appsv1.StatefulSet {
+	statefulSet := b.statefulSet.DeepCopy()
+	statefulSet.Spec.Template = b.pod.template(labels, statefulSet.Spec.Selector.MatchLabels)
+	main := &statefulSet.Spec.Template.Spec.Containers[0]
+	main.VolumeMounts = append(main.VolumeMounts, b.claimMounts...)
+	return statefulSet
+}
+
+// Create creates the stateful set.
+func (b *StatefulSetBuilder) Create(f *framework.Framework) (*appsv1.StatefulSet, error) {
+	statefulSet := b.build(f.StandardLabels())
+	prepare(f, &statefulSet.ObjectMeta, true)
+	f.MutatePodSpec(&statefulSet.Spec.Template.Spec)
+	return f.ClientSet.AppsV1().StatefulSets(statefulSet.Namespace).Create(statefulSet)
+}
+
+// CreateAndWait creates the stateful set and waits for all its replicas to be ready.
+func (b *StatefulSetBuilder) CreateAndWait(f *framework.Framework) (*appsv1.StatefulSet, error) {
+	statefulSet, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := statefulSet.Namespace, statefulSet.Name
+	err = f.WaitUntil(f.Timeouts.PodStart, func() (bool, error) {
+		statefulSet, err = f.ClientSet.AppsV1().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+			statefulSet.Status.ReadyReplicas == *statefulSet.Spec.Replicas, nil
+	})
+	if err != nil {
+		return statefulSet, fmt.Errorf("error waiting for stateful set %s/%s to be ready: %v", namespace, name, err)
+	}
+	return statefulSet, nil
+}
+
+// JobBuilder builds a job, see NewJob.
+type JobBuilder struct {
+	job *batchv1.Job
+	pod *PodBuilder
+}
+
+// NewJob returns a builder of a job of one completion, without retries. The
+// pods are built by NewPod(name) unless set with WithPod, they aren't
+// restarted unless they have a restart policy.
+func NewJob(name string) *JobBuilder {
+	backoffLimit := int32(0)
+	return &JobBuilder{
+		job: &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: batchv1.JobSpec{
+				BackoffLimit: &backoffLimit,
+			},
+		},
+		pod: NewPod(name),
+	}
+}
+
+// WithNamespace sets the namespace, the framework namespace by default.
+func (b *JobBuilder) WithNamespace(namespace string) *JobBuilder {
+	b.job.Namespace = namespace
+	return b
+}
+
+// WithLabels adds labels to the job.
+func (b *JobBuilder) WithLabels(labels map[string]string) *JobBuilder {
+	b.job.Labels = merge(b.job.Labels, labels)
+	return b
+}
+
+// WithCompletions sets the number of successful pods and how many run at once.
+func (b *JobBuilder) WithCompletions(completions, parallelism int32) *JobBuilder {
+	b.job.Spec.Completions = &completions
+	b.job.Spec.Parallelism = &parallelism
+	return b
+}
+
+// WithBackoffLimit sets how many failed pods are retried.
+func (b *JobBuilder) WithBackoffLimit(limit int32) *JobBuilder {
+	b.job.Spec.BackoffLimit = &limit
+	return b
+}
+
+// WithPod sets the builder of the pods.
+func (b *JobBuilder) WithPod(pod *PodBuilder) *JobBuilder {
+	b.pod = pod
+	return b
+}
+
+// Build returns the job, without the defaults of the framework.
+func (b *JobBuilder) Build() *batchv1.Job {
+	return b.build(nil)
+}
+
+func (b *JobBuilder) build(labels map[string]string) *batchv1.Job {
+	job := b.job.DeepCopy()
+	job.Spec.Template = b.pod.template(labels, nil)
+	if job.Spec.Template.Spec.RestartPolicy == "" {
+		job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+	}
+	return job
+}
+
+// Create creates the job.
+func (b *JobBuilder) Create(f *framework.Framework) (*batchv1.Job, error) {
+	job := b.build(f.StandardLabels())
+	prepare(f, &job.ObjectMeta, true)
+	f.MutatePodSpec(&job.Spec.Template.Spec)
+	return f.ClientSet.BatchV1().Jobs(job.Namespace).Create(job)
+}
+
+// CreateAndWait creates the job and waits for it to complete. It returns an
+// error if the job fails.
+func (b *JobBuilder) CreateAndWait(f *framework.Framework) (*batchv1.Job, error) {
+	job, err := b.Create(f)
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := job.Namespace, job.Name
+	err = f.WaitUntil(f.Timeouts.PodStart, func() (bool, error) {
+		job, err = f.ClientSet.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != v1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				return false, fmt.Errorf("job failed: %s", condition.Message)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return job, fmt.Errorf("error waiting for job %s/%s to complete: %v", namespace, name, err)
+	}
+	return job, nil
+}
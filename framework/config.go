@@ -0,0 +1,185 @@
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zryfish/framework/framework/junit"
+	"github.com/zryfish/framework/framework/redact"
+	"sigs.k8s.io/yaml"
+)
+
+// configFileFlag is the flag, and configFileEnv the environment variable, giving the path of the config file.
+const (
+	configFileFlag = "e2e-config"
+	configFileEnv  = "E2E_CONFIG"
+)
+
+// Sources of a setting, from the lowest to the highest precedence.
+const (
+	sourceDefault = "default"
+	sourceConfig  = "config"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+var (
+	// configFile is the path of the YAML config file.
+	configFile string
+	// configFlags are the flags registered by RegisterFlags, they can be set by the config file and the environment.
+	configFlags []string
+	// configSources records where the value of every setting comes from.
+	configSources = map[string]string{}
+	// configSections are the custom sections registered by the suites.
+	configSections = map[string]interface{}{}
+)
+
+// RegisterConfigSection registers a custom section of the config file, the
+// section named name is decoded into section, a pointer to a struct with json
+// tags, when the flags are read. It must be called before AfterReadingAllFlags.
+func RegisterConfigSection(name string, section interface{}) {
+	if flag.Lookup(name) != nil {
+		panic(fmt.Sprintf("config section %q has the name of a flag", name))
+	}
+	if _, ok := configSections[name]; ok {
+		panic(fmt.Sprintf("config section %q registered twice", name))
+	}
+	configSections[name] = section
+}
+
+// ConfigEnvVar returns the environment variable setting a flag, E2E_ followed
+// by the flag name in upper case, e.g. E2E_REPORT_DIR for --report-dir.
+func ConfigEnvVar(name string) string {
+	return "E2E_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// applyConfig sets the flags registered by RegisterFlags that weren't given on
+// the command line from the environment, then from the config file, and decodes
+// the custom sections of the config file.
+func applyConfig() error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	path := configFile
+	if path == "" {
+		path = os.Getenv(configFileEnv)
+	}
+
+	settings := map[string]json.RawMessage{}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading config file: %v", err)
+		}
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+	}
+	known := map[string]bool{}
+	for _, name := range configFlags {
+		known[name] = true
+	}
+	for name, raw := range settings {
+		if section, ok := configSections[name]; ok {
+			decoder := json.NewDecoder(bytes.NewReader(raw))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(section); err != nil {
+				return fmt.Errorf("invalid section %q in config file %s: %v", name, path, err)
+			}
+			continue
+		}
+		if !known[name] {
+			return fmt.Errorf("unknown setting %q in config file %s", name, path)
+		}
+	}
+
+	for _, name := range configFlags {
+		switch {
+		case set[name]:
+			configSources[name] = sourceFlag
+		case os.Getenv(ConfigEnvVar(name)) != "":
+			if err := flag.Set(name, os.Getenv(ConfigEnvVar(name))); err != nil {
+				return fmt.Errorf("invalid value for %s in %s: %v", name, ConfigEnvVar(name), err)
+			}
+			configSources[name] = sourceEnv
+		case settings[name] != nil:
+			value, err := configValue(settings[name])
+			if err != nil {
+				return fmt.Errorf("invalid value for %s in config file %s: %v", name, path, err)
+			}
+			if err := flag.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value for %s in config file %s: %v", name, path, err)
+			}
+			configSources[name] = sourceConfig
+		default:
+			configSources[name] = sourceDefault
+		}
+	}
+	return nil
+}
+
+// configValue returns the flag value of a scalar setting of the config file.
+func configValue(raw json.RawMessage) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, float64:
+		return string(raw), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected a string, number or boolean, got %s", raw)
+	}
+}
+
+// validate checks the settings which can't be checked when they are parsed.
+func (t *TestContextType) validate() error {
+	if t.SpecRetries < 0 {
+		return fmt.Errorf("spec-retries must not be negative, got %d", t.SpecRetries)
+	}
+	if t.ClientLogVerbosity < 0 {
+		return fmt.Errorf("client-log-verbosity must not be negative, got %d", t.ClientLogVerbosity)
+	}
+	switch t.KubeAPIContentType {
+	case "", "application/json", "application/vnd.kubernetes.protobuf":
+	default:
+		return fmt.Errorf("kube-api-content-type must be application/json or application/vnd.kubernetes.protobuf, got %q", t.KubeAPIContentType)
+	}
+	if t.Host != "" {
+		if u, err := url.Parse(t.Host); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("host must be a URL like %s, got %q", defaultHost, t.Host)
+		}
+	}
+	return nil
+}
+
+// configProperties returns the effective value and the source of every setting,
+// as report properties named Config.<flag>.
+func configProperties() []junit.Property {
+	names := append([]string{}, configFlags...)
+	sort.Strings(names)
+	var properties []junit.Property
+	for _, name := range names {
+		source, ok := configSources[name]
+		if !ok {
+			continue
+		}
+		properties = append(properties, junit.Property{
+			Name:  "Config." + name,
+			Value: redact.String(fmt.Sprintf("%s (%s)", flag.Lookup(name).Value.String(), source)),
+		})
+	}
+	return properties
+}
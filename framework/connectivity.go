@@ -0,0 +1,399 @@
+package framework
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zryfish/framework/framework/image"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// probeContainer is the container of the probe pods the probes are run from.
+	probeContainer = "probe"
+	// probeLabel selects a probe pod, for its service and network policies.
+	probeLabel = "e2e-probe"
+	// probeTimeout bounds a single connection attempt.
+	probeTimeout = 3 * time.Second
+	// probeAttempts is how many times mismatching probes are run, the network
+	// may take a moment to converge, e.g. after a network policy change.
+	probeAttempts = 3
+	// probeWorkers is how many probes run at once.
+	probeWorkers = 16
+	// probeHTTPPortBase is the first port of the HTTP servers of the ports
+	// served over UDP or SCTP only, netexec always serves HTTP.
+	probeHTTPPortBase = 18080
+)
+
+// ProbeTarget is how a probe pod is addressed.
+type ProbeTarget string
+
+const (
+	// ProbePodIP addresses the pod IP.
+	ProbePodIP ProbeTarget = "pod-ip"
+	// ProbeServiceIP addresses the cluster IP of the service of the pod.
+	ProbeServiceIP ProbeTarget = "service-ip"
+	// ProbeServiceDNS addresses the DNS name of the service of the pod.
+	ProbeServiceDNS ProbeTarget = "service-dns"
+)
+
+// ProbePort is a port served by a probe pod.
+type ProbePort struct {
+	Port     int32
+	Protocol v1.Protocol
+}
+
+// ProbePod is a pod serving ports for the connectivity checks, with a service
+// selecting it. The probes are run from its "probe" container.
+type ProbePod struct {
+	// Namespace defaults to the namespace of the framework.
+	Namespace string
+	Name      string
+	// NodeName places the pod on a node when set.
+	NodeName string
+	// Labels are added to the pod, e.g. to select it in network policies.
+	Labels map[string]string
+	Ports  []ProbePort
+
+	// PodIP and ServiceIP are set once the pod is created.
+	PodIP     string
+	ServiceIP string
+}
+
+// String returns the namespace and name of the pod.
+func (p *ProbePod) String() string {
+	return p.Namespace + "/" + p.Name
+}
+
+// address returns the address of a port of the pod. The pods without ports
+// have no service to address.
+func (p *ProbePod) address(target ProbeTarget, port int32) (string, error) {
+	if p.PodIP == "" {
+		return "", fmt.Errorf("probe pod %s isn't created", p)
+	}
+	host := p.PodIP
+	switch target {
+	case ProbeServiceIP, ProbeServiceDNS:
+		if p.ServiceIP == "" {
+			return "", fmt.Errorf("probe pod %s has no ports, it has no service to probe over %s", p, target)
+		}
+		host = p.ServiceIP
+		if target == ProbeServiceDNS {
+			// the search path of the pod completes the name with the cluster domain
+			host = fmt.Sprintf("%s.%s.svc", p.Name, p.Namespace)
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// CreateProbePods creates the probe pods and their services, and waits for the pods to be running.
+func (f *Framework) CreateProbePods(pods ...*ProbePod) error {
+	for _, p := range pods {
+		if p.Namespace == "" {
+			p.Namespace = f.Namespace.Name
+		}
+		pod := probePodSpec(p)
+		f.MutatePodSpec(&pod.Spec)
+		if _, err := f.ClientSet.CoreV1().Pods(p.Namespace).Create(pod); err != nil {
+			return fmt.Errorf("error creating probe pod %s: %v", p, err)
+		}
+		if len(p.Ports) > 0 {
+			service, err := f.ClientSet.CoreV1().Services(p.Namespace).Create(probeServiceSpec(p))
+			if err != nil {
+				return fmt.Errorf("error creating the service of probe pod %s: %v", p, err)
+			}
+			p.ServiceIP = service.Spec.ClusterIP
+		}
+	}
+	for _, p := range pods {
+		pod, err := waitForPodRunning(f.Context(), f.ClientSet, p.Namespace, p.Name, f.Timeouts.Poll, f.Timeouts.PodStart)
+		if err != nil {
+			return err
+		}
+		p.PodIP = pod.Status.PodIP
+	}
+	return nil
+}
+
+func probePodSpec(p *ProbePod) *v1.Pod {
+	labels := map[string]string{probeLabel: p.Name}
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   p.Name,
+			Labels: labels,
+		},
+		Spec: v1.PodSpec{
+			NodeName: p.NodeName,
+			Containers: []v1.Container{{
+				Name:  probeContainer,
+				Image: image.Get(image.Agnhost),
+				Args:  []string{"pause"},
+			}},
+		},
+	}
+	pod.Spec.Containers = append(pod.Spec.Containers, probeServers(p.Ports)...)
+	return pod
+}
+
+// probeServers returns the containers serving the ports, a netexec server per
+// port number, serving it over each of its protocols. netexec always serves
+// HTTP, the port numbers without TCP get it on a port from probeHTTPPortBase.
+func probeServers(ports []ProbePort) []v1.Container {
+	var numbers []int32
+	protocols := map[int32]map[v1.Protocol]bool{}
+	for _, port := range ports {
+		if protocols[port.Port] == nil {
+			numbers = append(numbers, port.Port)
+			protocols[port.Port] = map[v1.Protocol]bool{}
+		}
+		protocols[port.Port][port.Protocol] = true
+	}
+
+	nextHTTPPort := int32(probeHTTPPortBase)
+	var containers []v1.Container
+	for _, number := range numbers {
+		httpPort, udpPort, sctpPort := number, int32(-1), int32(-1)
+		if !protocols[number][v1.ProtocolTCP] {
+			for protocols[nextHTTPPort][v1.ProtocolTCP] {
+				nextHTTPPort++
+			}
+			httpPort = nextHTTPPort
+			nextHTTPPort++
+		}
+		if protocols[number][v1.ProtocolUDP] {
+			udpPort = number
+		}
+		if protocols[number][v1.ProtocolSCTP] {
+			sctpPort = number
+		}
+		container := v1.Container{
+			Name:  fmt.Sprintf("serve-%d", number),
+			Image: image.Get(image.Agnhost),
+			Args: []string{"netexec",
+				"--http-port=" + strconv.Itoa(int(httpPort)),
+				"--udp-port=" + strconv.Itoa(int(udpPort)),
+				"--sctp-port=" + strconv.Itoa(int(sctpPort)),
+			},
+		}
+		for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP} {
+			if protocols[number][protocol] {
+				container.Ports = append(container.Ports, v1.ContainerPort{ContainerPort: number, Protocol: protocol})
+			}
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
+
+func probeServiceSpec(p *ProbePod) *v1.Service {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: p.Name},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{probeLabel: p.Name},
+		},
+	}
+	for _, port := range p.Ports {
+		service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{
+			Name:       fmt.Sprintf("%s-%d", strings.ToLower(string(port.Protocol)), port.Port),
+			Port:       port.Port,
+			TargetPort: intstr.FromInt(int(port.Port)),
+			Protocol:   port.Protocol,
+		})
+	}
+	return service
+}
+
+// ConnectivityMatrix is the expected reachability between probe pods, on a
+// port, addressed the same way.
+type ConnectivityMatrix struct {
+	Pods     []*ProbePod
+	Target   ProbeTarget
+	Port     int32
+	Protocol v1.Protocol
+
+	expected map[[2]*ProbePod]bool
+	// addresses are the probed addresses of the pods, set by CheckConnectivity.
+	addresses map[*ProbePod]string
+}
+
+// NewConnectivityMatrix returns a matrix where every pod reaches, or doesn't
+// reach, every pod.
+func NewConnectivityMatrix(pods []*ProbePod, target ProbeTarget, port ProbePort, reachable bool) *ConnectivityMatrix {
+	m := &ConnectivityMatrix{
+		Pods:     pods,
+		Target:   target,
+		Port:     port.Port,
+		Protocol: port.Protocol,
+		expected: map[[2]*ProbePod]bool{},
+	}
+	for _, from := range pods {
+		for _, to := range pods {
+			m.expected[[2]*ProbePod{from, to}] = reachable
+		}
+	}
+	return m
+}
+
+// Expect sets whether from reaches to.
+func (m *ConnectivityMatrix) Expect(from, to *ProbePod, reachable bool) {
+	m.expected[[2]*ProbePod{from, to}] = reachable
+}
+
+// ExpectFrom sets whether from reaches every pod.
+func (m *ConnectivityMatrix) ExpectFrom(from *ProbePod, reachable bool) {
+	for _, to := range m.Pods {
+		m.Expect(from, to, reachable)
+	}
+}
+
+// ExpectTo sets whether every pod reaches to.
+func (m *ConnectivityMatrix) ExpectTo(to *ProbePod, reachable bool) {
+	for _, from := range m.Pods {
+		m.Expect(from, to, reachable)
+	}
+}
+
+// CheckConnectivity probes the connections of the matrix, in parallel, and
+// returns an error with the truth tables of the expected and observed
+// reachability if they differ. Mismatching probes are run again a few times
+// before failing.
+func (f *Framework) CheckConnectivity(m *ConnectivityMatrix) error {
+	m.addresses = map[*ProbePod]string{}
+	for _, p := range m.Pods {
+		address, err := p.address(m.Target, m.Port)
+		if err != nil {
+			return err
+		}
+		m.addresses[p] = address
+	}
+
+	observed := map[[2]*ProbePod]bool{}
+	pending := make([][2]*ProbePod, 0, len(m.expected))
+	for pair := range m.expected {
+		pending = append(pending, pair)
+	}
+
+	for attempt := 1; attempt <= probeAttempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			Logf("%d probes don't match the expected reachability, probing again in %v", len(pending), f.Timeouts.Poll)
+			select {
+			case <-f.Context().Done():
+				return f.Context().Err()
+			case <-time.After(f.Timeouts.Poll):
+			}
+		}
+		results := f.runProbes(m, pending)
+		pending = pending[:0]
+		for pair, reachable := range results {
+			observed[pair] = reachable
+			if reachable != m.expected[pair] {
+				pending = append(pending, pair)
+			}
+		}
+	}
+
+	table := m.truthTables(observed)
+	if len(pending) > 0 {
+		return fmt.Errorf("%d of %d connections don't match the expected reachability on %s port %d over %s:\n%s", len(pending), len(m.expected), m.Protocol, m.Port, m.Target, table)
+	}
+	Logf("Connectivity on %s port %d over %s as expected:\n%s", m.Protocol, m.Port, m.Target, table)
+	return nil
+}
+
+// runProbes probes the connections between the pairs of pods, in parallel.
+func (f *Framework) runProbes(m *ConnectivityMatrix, pairs [][2]*ProbePod) map[[2]*ProbePod]bool {
+	var lock sync.Mutex
+	results := map[[2]*ProbePod]bool{}
+	work := make(chan [2]*ProbePod)
+	var wg sync.WaitGroup
+	for i := 0; i < probeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pair := range work {
+				reachable := f.probe(pair[0], pair[1], m)
+				lock.Lock()
+				results[pair] = reachable
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, pair := range pairs {
+		work <- pair
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// probe returns true if from connects to a port of to.
+func (f *Framework) probe(from, to *ProbePod, m *ConnectivityMatrix) bool {
+	address := m.addresses[to]
+	r, err := f.ExecWithOptions(ExecOptions{
+		Command:       []string{"/agnhost", "connect", address, "--timeout=" + probeTimeout.String(), "--protocol=" + strings.ToLower(string(m.Protocol))},
+		Namespace:     from.Namespace,
+		PodName:       from.Name,
+		ContainerName: probeContainer,
+		Timeout:       2 * probeTimeout,
+	})
+	if err != nil {
+		Logf("Failed to probe %s from %s: %v", address, from, err)
+		return false
+	}
+	return r.ExitCode == 0
+}
+
+// truthTables renders the expected and observed reachability, and their
+// differences, with the sources as rows and the destinations as columns.
+func (m *ConnectivityMatrix) truthTables(observed map[[2]*ProbePod]bool) string {
+	pods := append([]*ProbePod{}, m.Pods...)
+	sort.Slice(pods, func(i, j int) bool { return pods[i].String() < pods[j].String() })
+
+	var buf bytes.Buffer
+	render := func(title string, cell func(pair [2]*ProbePod) string) {
+		fmt.Fprintf(&buf, "%s:\n", title)
+		w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+		fmt.Fprint(w, "-\t")
+		for _, to := range pods {
+			fmt.Fprintf(w, "%s\t", to)
+		}
+		fmt.Fprintln(w)
+		for _, from := range pods {
+			fmt.Fprintf(w, "%s\t", from)
+			for _, to := range pods {
+				fmt.Fprintf(w, "%s\t", cell([2]*ProbePod{from, to}))
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	}
+	reachability := func(reachable bool) string {
+		if reachable {
+			return "."
+		}
+		return "X"
+	}
+
+	render("Expected (. reachable, X unreachable)", func(pair [2]*ProbePod) string {
+		return reachability(m.expected[pair])
+	})
+	render("Observed", func(pair [2]*ProbePod) string {
+		return reachability(observed[pair])
+	})
+	render("Differences (. as expected, X mismatch)", func(pair [2]*ProbePod) string {
+		return reachability(observed[pair] == m.expected[pair])
+	})
+	return buf.String()
+}
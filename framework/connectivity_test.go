@@ -0,0 +1,73 @@
+package framework
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestProbeServers(t *testing.T) {
+	ports := []ProbePort{
+		{Port: 80, Protocol: v1.ProtocolTCP},
+		{Port: 53, Protocol: v1.ProtocolUDP},
+		{Port: 53, Protocol: v1.ProtocolTCP},
+		{Port: 9000, Protocol: v1.ProtocolSCTP},
+		{Port: 18080, Protocol: v1.ProtocolTCP},
+		{Port: 5000, Protocol: v1.ProtocolUDP},
+	}
+	want := []struct {
+		name  string
+		args  []string
+		ports []v1.ContainerPort
+	}{
+		{"serve-80", []string{"netexec", "--http-port=80", "--udp-port=-1", "--sctp-port=-1"}, []v1.ContainerPort{{ContainerPort: 80, Protocol: v1.ProtocolTCP}}},
+		{"serve-53", []string{"netexec", "--http-port=53", "--udp-port=53", "--sctp-port=-1"}, []v1.ContainerPort{{ContainerPort: 53, Protocol: v1.ProtocolTCP}, {ContainerPort: 53, Protocol: v1.ProtocolUDP}}},
+		// 18080 is served over TCP already
+		{"serve-9000", []string{"netexec", "--http-port=18081", "--udp-port=-1", "--sctp-port=9000"}, []v1.ContainerPort{{ContainerPort: 9000, Protocol: v1.ProtocolSCTP}}},
+		{"serve-18080", []string{"netexec", "--http-port=18080", "--udp-port=-1", "--sctp-port=-1"}, []v1.ContainerPort{{ContainerPort: 18080, Protocol: v1.ProtocolTCP}}},
+		{"serve-5000", []string{"netexec", "--http-port=18082", "--udp-port=5000", "--sctp-port=-1"}, []v1.ContainerPort{{ContainerPort: 5000, Protocol: v1.ProtocolUDP}}},
+	}
+	containers := probeServers(ports)
+	if len(containers) != len(want) {
+		t.Fatalf("probeServers() returned %d containers, want %d", len(containers), len(want))
+	}
+	for i, c := range containers {
+		if c.Name != want[i].name || !reflect.DeepEqual(c.Args, want[i].args) || !reflect.DeepEqual(c.Ports, want[i].ports) {
+			t.Errorf("container %d = %s %v %v, want %s %v %v", i, c.Name, c.Args, c.Ports, want[i].name, want[i].args, want[i].ports)
+		}
+	}
+}
+
+func TestProbePodAddress(t *testing.T) {
+	served := &ProbePod{Namespace: "e2e", Name: "a", PodIP: "10.0.0.1", ServiceIP: "10.96.0.1"}
+	portless := &ProbePod{Namespace: "e2e", Name: "b", PodIP: "10.0.0.2"}
+	pending := &ProbePod{Namespace: "e2e", Name: "c"}
+	tests := []struct {
+		pod    *ProbePod
+		target ProbeTarget
+		want   string
+		err    string
+	}{
+		{pod: served, target: ProbePodIP, want: "10.0.0.1:80"},
+		{pod: served, target: ProbeServiceIP, want: "10.96.0.1:80"},
+		{pod: served, target: ProbeServiceDNS, want: "a.e2e.svc:80"},
+		{pod: portless, target: ProbePodIP, want: "10.0.0.2:80"},
+		{pod: portless, target: ProbeServiceIP, err: "has no service"},
+		{pod: portless, target: ProbeServiceDNS, err: "has no service"},
+		{pod: pending, target: ProbePodIP, err: "isn't created"},
+	}
+	for _, test := range tests {
+		got, err := test.pod.address(test.target, 80)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("address(%s, %s) error = %v, want an error containing %q", test.pod, test.target, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("address(%s, %s) = %q, %v, want %q", test.pod, test.target, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// cleanupTimeout bounds the cleanup of each spec of an interrupted run.
+const cleanupTimeout = 30 * time.Second
+
+var (
+	// suiteContext is the parent of the spec contexts, it is canceled on SIGINT and SIGTERM.
+	suiteContext, cancelSuite = context.WithCancel(context.Background())
+	handleInterruptsOnce      sync.Once
+
+	activeLock sync.Mutex
+	// activeFrameworks are the frameworks of the running specs.
+	activeFrameworks = map[*Framework]bool{}
+)
+
+// SuiteContext returns the context of the run, canceled when the run is interrupted.
+func SuiteContext() context.Context {
+	return suiteContext
+}
+
+// handleInterrupts cancels the suite context on SIGINT and SIGTERM, so running
+// waits return. Ginkgo handles the signal too: it runs the AfterSuite, where
+// CleanupActiveNamespaces deletes the namespaces of the interrupted specs.
+func handleInterrupts() {
+	handleInterruptsOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-c
+			// a second signal is left to ginkgo, or kills the process
+			signal.Stop(c)
+			Logf("Received %v, canceling the running waits", sig)
+			cancelSuite()
+		}()
+	})
+}
+
+// pollImmediate is wait.PollImmediate returning early when ctx is done. It
+// returns the error of ctx if it was canceled, and wait.ErrWaitTimeout on timeout.
+func pollImmediate(ctx context.Context, interval, timeout time.Duration, condition wait.ConditionFunc) error {
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := wait.PollImmediateUntil(interval, condition, pollCtx.Done())
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// WaitUntil checks condition every poll interval of the framework until it is
+// true, returns an error, timeout or the spec ends.
+func (f *Framework) WaitUntil(timeout time.Duration, condition wait.ConditionFunc) error {
+	return pollImmediate(f.Context(), f.Timeouts.Poll, timeout, condition)
+}
+
+// contextRoundTripper sends the requests without context of a client with the
+// context returned by ctx, so requests are canceled with the spec.
+type contextRoundTripper struct {
+	ctx func() context.Context
+	rt  http.RoundTripper
+}
+
+func (t *contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context() == context.Background() {
+		req = req.WithContext(t.ctx())
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// withContext makes the requests of clients created from config use the context returned by ctx.
+func withContext(config *restclient.Config, ctx func() context.Context) {
+	config.WrapTransport = transport.Wrappers(config.WrapTransport, func(rt http.RoundTripper) http.RoundTripper {
+		return &contextRoundTripper{ctx: ctx, rt: rt}
+	})
+}
+
+// CleanupActiveNamespaces runs the cleanups registered by the specs which
+// haven't finished, e.g. deleting their cluster scoped objects, and deletes
+// their namespaces, left behind when the run is interrupted. It doesn't wait
+// for the namespaces to be gone. It must be called in the AfterSuite, which
+// ginkgo runs on interrupts, and does nothing once all specs have finished.
+func CleanupActiveNamespaces() {
+	activeLock.Lock()
+	defer activeLock.Unlock()
+	for f := range activeFrameworks {
+		// the spec context is canceled and the spec may still run, its context
+		// is left as is: the requests of its clients use the cleanup context,
+		// its waits still end, and the namespaces are deleted with a client of
+		// the cleanup context
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		f.lock.Lock()
+		f.cleanupCtx = ctx
+		cleanups := f.cleanups
+		f.cleanups = nil
+		namespaces := f.namespacesToDelete
+		f.lock.Unlock()
+
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			if err := cleanups[i](); err != nil {
+				Logf("Failed to clean up after the interrupted spec: %v", err)
+			}
+		}
+		if TestContext.DeleteNamespace && len(namespaces) > 0 {
+			deleteNamespaces(ctx, namespaces)
+		}
+
+		cancel()
+		f.lock.Lock()
+		f.cleanupCtx = nil
+		f.lock.Unlock()
+	}
+}
+
+// deleteNamespaces deletes namespaces, without waiting for them to be gone,
+// with a client whose requests use ctx.
+func deleteNamespaces(ctx context.Context, namespaces []*v1.Namespace) {
+	config, err := LoadConfig()
+	if err != nil {
+		Logf("Failed to load the client config to delete the namespaces: %v", err)
+		return
+	}
+	withContext(config, func() context.Context { return ctx })
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		Logf("Failed to create a client to delete the namespaces: %v", err)
+		return
+	}
+	for _, ns := range namespaces {
+		Logf("Deleting namespace %s of the interrupted spec", ns.Name)
+		if err := client.CoreV1().Namespaces().Delete(ns.Name, &metav1.DeleteOptions{}); err != nil {
+			Logf("Failed to delete namespace %s: %v", ns.Name, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package framework
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultCopyMaxSize is the size limit of the files copied to or from a pod.
+const DefaultCopyMaxSize = 64 << 20
+
+// errCopyTooLarge is returned when the copied files exceed the size limit.
+var errCopyTooLarge = errors.New("copied files exceed the size limit")
+
+// CopyOptions are the options of a copy to or from a container. The copy is a
+// tar archive streamed over the exec subresource, the container needs tar,
+// find and sha256sum, which busybox has.
+type CopyOptions struct {
+	// Namespace defaults to the namespace of the framework.
+	Namespace     string
+	PodName       string
+	ContainerName string
+
+	// LocalPath and RemotePath are the file or directory copied and its
+	// destination, directories are copied recursively.
+	LocalPath  string
+	RemotePath string
+
+	// MaxSize limits the size of the copied archive, DefaultCopyMaxSize if 0.
+	MaxSize int64
+	// Timeout bounds each command run in the container, 0 for the spec context only.
+	Timeout time.Duration
+}
+
+func (o CopyOptions) exec(command string) ExecOptions {
+	return ExecOptions{
+		Command:       []string{"/bin/sh", "-c", command},
+		Namespace:     o.Namespace,
+		PodName:       o.PodName,
+		ContainerName: o.ContainerName,
+		Timeout:       o.Timeout,
+	}
+}
+
+func (o CopyOptions) maxSize() int64 {
+	if o.MaxSize > 0 {
+		return o.MaxSize
+	}
+	return DefaultCopyMaxSize
+}
+
+// CopyToPod copies a local file or directory into a container, keeping the
+// file modes, and verifies the checksums of the copied files.
+func (f *Framework) CopyToPod(options CopyOptions) error {
+	var archive bytes.Buffer
+	sums, err := writeTar(&archive, options.LocalPath, path.Base(options.RemotePath), options.maxSize())
+	if err != nil {
+		return fmt.Errorf("error archiving %s: %v", options.LocalPath, err)
+	}
+
+	dir := path.Dir(options.RemotePath)
+	execOptions := options.exec(fmt.Sprintf("mkdir -p %s && tar -xf - -C %s", shellQuote(dir), shellQuote(dir)))
+	execOptions.Stdin = &archive
+	if err := execSucceeded(f.ExecWithOptions(execOptions)); err != nil {
+		return fmt.Errorf("error extracting %s into %s: %v", options.LocalPath, options.RemotePath, err)
+	}
+	return f.verifyRemoteChecksums(options, sums)
+}
+
+// CopyFromPod copies a file or directory of a container to the local
+// filesystem, keeping the file modes, and verifies the checksums of the copied
+// files. Symlinks and special files aren't copied.
+func (f *Framework) CopyFromPod(options CopyOptions) error {
+	dir, base := path.Dir(options.RemotePath), path.Base(options.RemotePath)
+	var archive bytes.Buffer
+	execOptions := options.exec(fmt.Sprintf("tar -cf - -C %s %s", shellQuote(dir), shellQuote(base)))
+	execOptions.Stdout = &limitWriter{w: &archive, remaining: options.maxSize()}
+	if err := execSucceeded(f.ExecWithOptions(execOptions)); err != nil {
+		return fmt.Errorf("error archiving %s: %v", options.RemotePath, err)
+	}
+
+	sums, err := readTar(&archive, options.LocalPath, base)
+	if err != nil {
+		return fmt.Errorf("error extracting %s into %s: %v", options.RemotePath, options.LocalPath, err)
+	}
+	return f.verifyRemoteChecksums(options, sums)
+}
+
+// CopyArtifactFromPod copies a file or directory of a container into the
+// artifacts of the running spec, and returns its local path.
+func (f *Framework) CopyArtifactFromPod(podName, containerName, remotePath string) (string, error) {
+	dir := f.ArtifactsDir()
+	if dir == "" {
+		return "", fmt.Errorf("error copying %s from pod %s: no report directory", remotePath, podName)
+	}
+	localPath := filepath.Join(dir, "pods", podName, containerName, path.Base(remotePath))
+	if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		return "", fmt.Errorf("error creating the directory of %s: %v", localPath, err)
+	}
+	return localPath, f.CopyFromPod(CopyOptions{
+		PodName:       podName,
+		ContainerName: containerName,
+		LocalPath:     localPath,
+		RemotePath:    remotePath,
+	})
+}
+
+// verifyRemoteChecksums compares the checksums of the copied files, by path
+// relative to the copied file or directory, with the files of the container.
+func (f *Framework) verifyRemoteChecksums(options CopyOptions, sums map[string]string) error {
+	dir, base := path.Dir(options.RemotePath), path.Base(options.RemotePath)
+	r, err := f.ExecWithOptions(options.exec(fmt.Sprintf("cd %s && find %s -type f -exec sha256sum {} +", shellQuote(dir), shellQuote(base))))
+	if err := execSucceeded(r, err); err != nil {
+		return fmt.Errorf("error computing the checksums of %s: %v", options.RemotePath, err)
+	}
+
+	remote := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(r.Stdout), "\n") {
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if rel, ok := archivePath(parts[1], base); ok {
+			remote[rel] = parts[0]
+		}
+	}
+	for rel, sum := range sums {
+		if remote[rel] != sum {
+			return fmt.Errorf("checksum mismatch for %s in %s: copied %s, container has %q", rel, options.RemotePath, sum, remote[rel])
+		}
+	}
+	return nil
+}
+
+// execSucceeded returns an error if a command failed to run or exited with a non zero code.
+func execSucceeded(r ExecResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if r.ExitCode != 0 {
+		return fmt.Errorf("exit code %d: %s", r.ExitCode, strings.TrimSpace(r.Stderr))
+	}
+	return nil
+}
+
+// writeTar archives the file or directory at src under the name base, and
+// returns the checksums of the archived files.
+func writeTar(w io.Writer, src, base string, maxSize int64) (map[string]string, error) {
+	sums := map[string]string{}
+	tw := tar.NewWriter(&limitWriter{w: w, remaining: maxSize})
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			Logf("Not copying %s, it isn't a regular file or a directory", file)
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(base, rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		in, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(tw, hash), in); err != nil {
+			return err
+		}
+		sums[rel] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, tw.Close()
+}
+
+// readTar extracts an archive of the file or directory base into dst, and
+// returns the checksums of the extracted files.
+func readTar(r io.Reader, dst, base string) (map[string]string, error) {
+	sums := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return sums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rel, ok := archivePath(header.Name, base)
+		if !ok {
+			return nil, fmt.Errorf("unexpected path %q in the archive of %s", header.Name, base)
+		}
+		file := filepath.Join(dst, filepath.FromSlash(rel))
+		mode := header.FileInfo().Mode().Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(file, os.ModePerm); err != nil {
+				return nil, err
+			}
+			// the umask applies to MkdirAll
+			if err := os.Chmod(file, mode); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+				return nil, err
+			}
+			sum, err := writeFile(file, tr, mode)
+			if err != nil {
+				return nil, err
+			}
+			sums[rel] = sum
+		default:
+			Logf("Not copying %s, it isn't a regular file or a directory", header.Name)
+		}
+	}
+}
+
+// writeFile writes a file with the given mode, and returns its checksum.
+func writeFile(file string, r io.Reader, mode os.FileMode) (string, error) {
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), r); err != nil {
+		return "", err
+	}
+	if err := out.Chmod(mode); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), out.Close()
+}
+
+// archivePath returns the path of an archived file relative to the copied
+// file or directory base, "." for base itself. It is false for paths outside
+// base, so a container can't write outside the destination.
+func archivePath(name, base string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if name == base {
+		return ".", true
+	}
+	rel := strings.TrimPrefix(name, base+"/")
+	if rel == name || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// limitWriter fails writes beyond the remaining bytes.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		return 0, errCopyTooLarge
+	}
+	l.remaining -= int64(len(p))
+	return l.w.Write(p)
+}
+
+// shellQuote quotes s for /bin/sh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
@@ -0,0 +1,170 @@
+package framework
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{name: "data", want: ".", ok: true},
+		{name: "data/", want: ".", ok: true},
+		{name: "./data", want: ".", ok: true},
+		{name: "data/a.txt", want: "a.txt", ok: true},
+		{name: "./data/sub/a.txt", want: "sub/a.txt", ok: true},
+		{name: "data/./sub//a.txt", want: "sub/a.txt", ok: true},
+		{name: "data/sub/../a.txt", want: "a.txt", ok: true},
+		{name: "data/../etc/passwd"},
+		{name: "data/../../etc/passwd"},
+		{name: "../data/a.txt"},
+		{name: "/data/a.txt"},
+		{name: "/etc/passwd"},
+		{name: "database/a.txt"},
+		{name: "other"},
+		{name: ".."},
+	}
+	for _, test := range tests {
+		got, ok := archivePath(test.name, "data")
+		if got != test.want || ok != test.ok {
+			t.Errorf("archivePath(%q, \"data\") = %q, %v, want %q, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestReadTarRejectsPathsOutsideBase(t *testing.T) {
+	tests := []string{"data/../escaped", "../escaped", "/escaped", "./other/escaped"}
+	for _, name := range tests {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		content := []byte("content")
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		dst := filepath.Join(dir, "dst")
+		if _, err := readTar(&archive, dst, "data"); err == nil {
+			t.Errorf("readTar of %q succeeded, want an error", name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+			t.Errorf("readTar of %q wrote outside the destination", name)
+		}
+	}
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	files := map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "bb",
+		"sub/deep/c.sh": "#!/bin/sh",
+	}
+	for name, content := range files {
+		file := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "sub", "deep", "c.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	written, err := writeTar(&archive, src, "data", DefaultCopyMaxSize)
+	if err != nil {
+		t.Fatalf("writeTar failed: %v", err)
+	}
+	dst := filepath.Join(dir, "dst")
+	read, err := readTar(&archive, dst, "data")
+	if err != nil {
+		t.Fatalf("readTar failed: %v", err)
+	}
+	if len(written) != len(files) || !reflect.DeepEqual(written, read) {
+		t.Errorf("checksums of the written files %v, of the read files %v", written, read)
+	}
+	for name, content := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("file %s = %q, %v, want %q", name, got, err, content)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dst, "sub", "deep", "c.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0755 {
+		t.Errorf("mode of c.sh = %v, want 0755", mode)
+	}
+}
+
+func TestTarRoundTripSingleFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "report.json")
+	if err := ioutil.WriteFile(src, []byte(`{"ok": true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	written, err := writeTar(&archive, src, "copy.json", DefaultCopyMaxSize)
+	if err != nil {
+		t.Fatalf("writeTar failed: %v", err)
+	}
+	dst := filepath.Join(dir, "out", "copy.json")
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readTar(&archive, dst, "copy.json")
+	if err != nil {
+		t.Fatalf("readTar failed: %v", err)
+	}
+	if _, ok := written["."]; !ok || !reflect.DeepEqual(written, read) {
+		t.Errorf("checksums of the written file %v, of the read file %v", written, read)
+	}
+	got, err := ioutil.ReadFile(dst)
+	if err != nil || string(got) != `{"ok": true}` {
+		t.Errorf("copied file = %q, %v", got, err)
+	}
+}
+
+func TestWriteTarSizeLimit(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "big")
+	if err := ioutil.WriteFile(src, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := writeTar(&archive, src, "big", 1024); err != errCopyTooLarge {
+		t.Errorf("writeTar error = %v, want %v", err, errCopyTooLarge)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "copy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
@@ -0,0 +1,159 @@
+package csimock
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zryfish/framework/framework"
+	"k8s.io/api/core/v1"
+)
+
+// callPrefix starts the log lines of the mock recording a call.
+const callPrefix = "gRPCCall:"
+
+// discoveryMethods are the calls the sidecars and the kubelet make to discover
+// the driver, left out of the errors of ExpectCallSequence.
+var discoveryMethods = map[string]bool{
+	"Probe":                     true,
+	"GetPluginInfo":             true,
+	"GetPluginCapabilities":     true,
+	"ControllerGetCapabilities": true,
+	"NodeGetCapabilities":       true,
+	"NodeGetInfo":               true,
+}
+
+// Call is a call of the driver, recorded by the mock.
+type Call struct {
+	// Method is the CSI method without its service, e.g. "NodePublishVolume".
+	Method string
+	// Request and Response are the messages of the call, as JSON.
+	Request  json.RawMessage
+	Response json.RawMessage
+	// Code is the code of the error of the call, CodeOK on success.
+	Code Code
+	// Error is the error of the call, "" on success.
+	Error string
+}
+
+// mockCall is a call as logged by the mock.
+type mockCall struct {
+	Method    string
+	Request   json.RawMessage
+	Response  json.RawMessage
+	Error     string
+	FullError struct {
+		Code    Code   `json:"code"`
+		Message string `json:"message"`
+	}
+}
+
+// DecodeRequest decodes the request of the call, e.g. into a map.
+func (c Call) DecodeRequest(v interface{}) error {
+	return json.Unmarshal(c.Request, v)
+}
+
+// String returns the method and the outcome of the call.
+func (c Call) String() string {
+	if c.Code != CodeOK {
+		return fmt.Sprintf("%s (code %d: %s)", c.Method, c.Code, c.Error)
+	}
+	return c.Method
+}
+
+// Calls returns the calls of the driver so far, in order, from the logs of
+// the mock. The calls of a previous run of the mock container are lost.
+func (d *Driver) Calls() ([]Call, error) {
+	namespace := d.f.Namespace.Name
+	logs, err := d.f.ClientSet.CoreV1().Pods(namespace).GetLogs(driverPodName, &v1.PodLogOptions{Container: mockContainer}).DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("error getting the logs of driver %s: %v", d.Name, err)
+	}
+	return parseCalls(string(logs))
+}
+
+// parseCalls returns the calls recorded in the logs of the mock.
+func parseCalls(logs string) ([]Call, error) {
+	var calls []Call
+	for _, line := range strings.Split(logs, "\n") {
+		i := strings.Index(line, callPrefix)
+		if i == -1 {
+			continue
+		}
+		var logged mockCall
+		if err := json.Unmarshal([]byte(line[i+len(callPrefix):]), &logged); err != nil {
+			return nil, fmt.Errorf("error decoding the call %q: %v", line, err)
+		}
+		// "/csi.v1.Node/NodePublishVolume" is "NodePublishVolume"
+		method := logged.Method[strings.LastIndex(logged.Method, "/")+1:]
+		calls = append(calls, Call{
+			Method:   method,
+			Request:  logged.Request,
+			Response: logged.Response,
+			Code:     logged.FullError.Code,
+			Error:    logged.Error,
+		})
+	}
+	return calls, nil
+}
+
+// CallsOf returns the calls of a method so far, in order.
+func (d *Driver) CallsOf(method string) ([]Call, error) {
+	calls, err := d.Calls()
+	if err != nil {
+		return nil, err
+	}
+	var matching []Call
+	for _, call := range calls {
+		if call.Method == method {
+			matching = append(matching, call)
+		}
+	}
+	return matching, nil
+}
+
+// WaitForCalls waits for the driver to receive at least n calls of a method,
+// e.g. the retries of a call failing with an injected error, and returns them.
+func (d *Driver) WaitForCalls(method string, n int) ([]Call, error) {
+	var calls []Call
+	err := d.f.WaitUntil(d.f.Timeouts.PodStart, func() (bool, error) {
+		var err error
+		calls, err = d.CallsOf(method)
+		if err != nil {
+			framework.Logf("Failed to get the calls of driver %s, retrying in %v: %v", d.Name, d.f.Timeouts.Poll, err)
+			return false, nil
+		}
+		return len(calls) >= n, nil
+	})
+	if err != nil {
+		return calls, fmt.Errorf("error waiting for %d calls of %s by driver %s, got %d: %v", n, method, d.Name, len(calls), err)
+	}
+	return calls, nil
+}
+
+// ExpectCallSequence returns an error unless the driver received calls of the
+// methods in this order, other calls may come in between, e.g.
+//
+//	err := driver.ExpectCallSequence("CreateVolume", "NodeStageVolume", "NodePublishVolume")
+func (d *Driver) ExpectCallSequence(methods ...string) error {
+	calls, err := d.Calls()
+	if err != nil {
+		return err
+	}
+	next := 0
+	for _, call := range calls {
+		if next < len(methods) && call.Method == methods[next] {
+			next++
+		}
+	}
+	if next < len(methods) {
+		var received []string
+		for _, call := range calls {
+			if !discoveryMethods[call.Method] {
+				received = append(received, call.String())
+			}
+		}
+		return fmt.Errorf("driver %s didn't receive %s in sequence %s, received %s", d.Name, methods[next], strings.Join(methods, ", "), strings.Join(received, ", "))
+	}
+	return nil
+}
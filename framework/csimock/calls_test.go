@@ -0,0 +1,66 @@
+package csimock
+
+import (
+	"reflect"
+	"testing"
+)
+
+// mockLogs are logs of the mock, with the calls of a volume published after
+// two failures.
+const mockLogs = `I0801 10:00:00.000000       1 main.go:90] Listening for connections on address: &net.UnixAddr{Name:"/csi/csi.sock", Net:"unix"}
+I0801 10:00:01.000000       1 main.go:120] gRPCCall: {"Method":"/csi.v1.Identity/Probe","Request":{},"Response":{},"Error":"","FullError":null}
+I0801 10:00:02.000000       1 main.go:120] gRPCCall: {"Method":"/csi.v1.Controller/CreateVolume","Request":{"name":"pvc-1","capacity_range":{"required_bytes":1073741824}},"Response":{"volume":{"capacity_bytes":1073741824,"volume_id":"1"}},"Error":"","FullError":null}
+I0801 10:00:03.000000       1 main.go:120] gRPCCall: {"Method":"/csi.v1.Node/NodePublishVolume","Request":{"volume_id":"1","target_path":"/var/lib/kubelet/pods/1/volumes/kubernetes.io~csi/pvc-1/mount"},"Response":null,"Error":"rpc error: code = Unavailable desc = injected","FullError":{"code":14,"message":"injected"}}
+I0801 10:00:04.000000       1 main.go:120] gRPCCall: {"Method":"/csi.v1.Node/NodePublishVolume","Request":{"volume_id":"1"},"Response":null,"Error":"rpc error: code = Unavailable desc = injected","FullError":{"code":14,"message":"injected"}}
+I0801 10:00:05.000000       1 main.go:120] gRPCCall: {"Method":"/csi.v1.Node/NodePublishVolume","Request":{"volume_id":"1"},"Response":{},"Error":"","FullError":null}
+`
+
+func TestParseCalls(t *testing.T) {
+	calls, err := parseCalls(mockLogs)
+	if err != nil {
+		t.Fatalf("parseCalls() failed: %v", err)
+	}
+	var got []string
+	for _, call := range calls {
+		got = append(got, call.String())
+	}
+	want := []string{
+		"Probe",
+		"CreateVolume",
+		"NodePublishVolume (code 14: rpc error: code = Unavailable desc = injected)",
+		"NodePublishVolume (code 14: rpc error: code = Unavailable desc = injected)",
+		"NodePublishVolume",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseCalls() = %q, want %q", got, want)
+	}
+
+	if calls[1].Code != CodeOK || calls[1].Error != "" {
+		t.Errorf("CreateVolume has code %d and error %q, want CodeOK and no error", calls[1].Code, calls[1].Error)
+	}
+	if calls[2].Code != CodeUnavailable {
+		t.Errorf("failed NodePublishVolume has code %d, want CodeUnavailable", calls[2].Code)
+	}
+	var request struct {
+		Name          string `json:"name"`
+		CapacityRange struct {
+			RequiredBytes int64 `json:"required_bytes"`
+		} `json:"capacity_range"`
+	}
+	if err := calls[1].DecodeRequest(&request); err != nil {
+		t.Fatalf("DecodeRequest() failed: %v", err)
+	}
+	if request.Name != "pvc-1" || request.CapacityRange.RequiredBytes != 1073741824 {
+		t.Errorf("DecodeRequest() = %+v, want pvc-1 of 1Gi", request)
+	}
+}
+
+func TestParseCallsErrors(t *testing.T) {
+	calls, err := parseCalls("")
+	if err != nil || len(calls) != 0 {
+		t.Errorf("parseCalls(\"\") = %v, %v, want no calls", calls, err)
+	}
+	if _, err := parseCalls(`I0801 10:00:01.000000       1 main.go:120] gRPCCall: {"Method":`); err == nil {
+		t.Errorf("parseCalls() of a truncated call didn't fail")
+	}
+}
@@ -0,0 +1,519 @@
+// Package csimock deploys a mock CSI driver, so specs test the volume lifecycle
+// on clusters without real storage, e.g.
+//
+//	driver, err := csimock.Deploy(f, csimock.Options{
+//		Faults: []csimock.Fault{{Method: "NodePublishVolume", Code: csimock.CodeUnavailable, Times: 2}},
+//	})
+//	...
+//	f.AddPodSpecMutator(driver.ScheduleOnNode)
+//	claim, err := f.CreateVolume(framework.VolumeOptions{Name: "data", StorageClass: driver.StorageClassName})
+//	...
+//	_, err = driver.WaitForCalls("NodePublishVolume", 3)
+//
+// The driver is the mock driver of csi-test, with the sidecars of the
+// controller, provisioner, attacher, resizer and snapshotter, and the node
+// driver registrar, in a single pod: the mock keeps its volumes in memory, so
+// the controller and node services must share it. Pods using its volumes must
+// run on its node, see ScheduleOnNode. The node service publishes a volume as
+// a directory on the node, its data doesn't outlive the publication.
+//
+// Every call of the driver is logged by the mock, and read back by Calls.
+// Errors and latency are injected with Faults, run by the mock as hooks.
+package csimock
+
+import (
+	"fmt"
+
+	"github.com/zryfish/framework/framework"
+	"github.com/zryfish/framework/framework/builders"
+	"github.com/zryfish/framework/framework/image"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Names of the images of the driver.
+const (
+	MockDriver          = "csi-mock-driver"
+	Provisioner         = "csi-provisioner"
+	Attacher            = "csi-attacher"
+	Resizer             = "csi-resizer"
+	Snapshotter         = "csi-snapshotter"
+	NodeDriverRegistrar = "csi-node-driver-registrar"
+)
+
+func init() {
+	image.Register(MockDriver, "k8s.gcr.io/sig-storage/mock-driver:v4.1.0")
+	image.Register(Provisioner, "k8s.gcr.io/sig-storage/csi-provisioner:v2.1.0")
+	image.Register(Attacher, "k8s.gcr.io/sig-storage/csi-attacher:v3.1.0")
+	image.Register(Resizer, "k8s.gcr.io/sig-storage/csi-resizer:v1.1.0")
+	image.Register(Snapshotter, "k8s.gcr.io/sig-storage/csi-snapshotter:v4.0.0")
+	image.Register(NodeDriverRegistrar, "k8s.gcr.io/sig-storage/csi-node-driver-registrar:v2.1.0")
+}
+
+const (
+	// driverPodName is the name of the pod of the driver, and of its service account and hooks config map.
+	driverPodName = "csi-mock"
+	// mockContainer is the container of the mock driver, whose logs record the calls.
+	mockContainer = "mock"
+	// socketDir is where the containers of the driver mount the directory of its socket.
+	socketDir = "/csi"
+	// hooksDir is where the mock mounts its hooks.
+	hooksDir = "/etc/hooks"
+	// hooksFile is the key of the hooks in their config map.
+	hooksFile = "hooks.yaml"
+	// kubeletDir is the root directory of the kubelet on the nodes.
+	kubeletDir = "/var/lib/kubelet"
+	// minServerVersion serves storage.k8s.io/v1 CSIDriver, as the sidecars need.
+	minServerVersion = "v1.18.0"
+	// minSnapshotServerVersion serves the v1 snapshot API of the snapshotter.
+	minSnapshotServerVersion = "v1.20.0"
+)
+
+var (
+	csiDriverResource           = schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "csidrivers"}
+	csiNodeResource             = schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "csinodes"}
+	volumeSnapshotClassResource = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotclasses"}
+	volumeSnapshotResource      = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+)
+
+// Options configure the driver.
+type Options struct {
+	// NodeName places the driver on a node, the scheduler picks one by default.
+	NodeName string
+	// AttachRequired makes the volumes attached with ControllerPublishVolume
+	// before they are staged on the node.
+	AttachRequired bool
+	// Snapshots runs the snapshotter and creates a volume snapshot class, the
+	// snapshot CRDs and the snapshot controller must be installed.
+	Snapshots bool
+	// DisableControllerExpansion and DisableNodeExpansion remove the expansion
+	// capabilities of the controller and node services.
+	DisableControllerExpansion bool
+	DisableNodeExpansion       bool
+	// Faults are injected into the calls of the driver, they can't be changed
+	// once the driver runs.
+	Faults []Fault
+}
+
+// Driver is a mock CSI driver deployed in the framework namespace. It is
+// removed in AfterEach, after the pods and claims using its storage class, so
+// it deletes its volumes.
+type Driver struct {
+	f *framework.Framework
+
+	// Name is the name of the driver, unique to the namespace.
+	Name string
+	// NodeName is the node the driver runs on.
+	NodeName string
+	// StorageClassName provisions volumes of the driver.
+	StorageClassName string
+	// SnapshotClassName snapshots volumes of the driver, with Options.Snapshots.
+	SnapshotClassName string
+
+	// hostname is the hostname label of the node, see ScheduleOnNode.
+	hostname string
+}
+
+// Deploy deploys the driver, its storage class, and its snapshot class, and
+// waits for the driver to be registered on its node. The spec is skipped on
+// servers older than the storage.k8s.io/v1 CSIDriver API the sidecars need,
+// or older than the snapshot.storage.k8s.io/v1 API with Options.Snapshots.
+func Deploy(f *framework.Framework, options Options) (*Driver, error) {
+	framework.SkipUnlessServerVersionGTE(f.ClientSet, minServerVersion)
+	if options.Snapshots {
+		framework.SkipUnlessServerVersionGTE(f.ClientSet, minSnapshotServerVersion)
+	}
+	namespace := f.Namespace.Name
+	d := &Driver{
+		f:                f,
+		Name:             "csi-mock-" + namespace,
+		StorageClassName: namespace + "-csi-mock",
+	}
+	if options.Snapshots {
+		d.SnapshotClassName = namespace + "-csi-mock"
+	}
+	if err := d.createRBAC(options); err != nil {
+		return nil, err
+	}
+	// registered after the RBAC objects, so it runs while the sidecars can delete the volumes
+	f.AddCleanup(d.teardown)
+	if err := d.createClusterObjects(options); err != nil {
+		return nil, err
+	}
+	hooks, err := faultHooks(options.Faults)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := builders.NewConfigMap(driverPodName).WithData(hooksFile, hooks).Create(f); err != nil {
+		return nil, fmt.Errorf("error creating the hooks of driver %s: %v", d.Name, err)
+	}
+
+	pod := d.podSpec(options)
+	f.MutatePodSpec(&pod.Spec)
+	if _, err := f.ClientSet.CoreV1().Pods(namespace).Create(pod); err != nil {
+		return nil, fmt.Errorf("error creating the pod of driver %s: %v", d.Name, err)
+	}
+	pod, err = f.WaitForPodRunning(driverPodName)
+	if err != nil {
+		return nil, err
+	}
+	d.NodeName = pod.Spec.NodeName
+	node, err := f.ClientSet.CoreV1().Nodes().Get(d.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting node %s of driver %s: %v", d.NodeName, d.Name, err)
+	}
+	d.hostname = node.Labels[v1.LabelHostname]
+	if err := d.waitForRegistration(); err != nil {
+		return nil, err
+	}
+	framework.Logf("Deployed CSI driver %s on node %s, storage class %s", d.Name, d.NodeName, d.StorageClassName)
+	return d, nil
+}
+
+// ScheduleOnNode places a pod on the node of the driver, e.g. as a pod spec
+// mutator of the framework. It selects the node instead of setting the node
+// name, so the claims of WaitForFirstConsumer storage classes are provisioned.
+func (d *Driver) ScheduleOnNode(spec *v1.PodSpec) {
+	if spec.NodeSelector == nil {
+		spec.NodeSelector = map[string]string{}
+	}
+	spec.NodeSelector[v1.LabelHostname] = d.hostname
+}
+
+// createRBAC creates the service account of the driver, and binds it to the
+// cluster role of the sidecars.
+func (d *Driver) createRBAC(options Options) error {
+	f := d.f
+	if _, err := builders.NewServiceAccount(driverPodName).Create(f); err != nil {
+		return fmt.Errorf("error creating the service account of driver %s: %v", d.Name, err)
+	}
+	role := builders.NewClusterRole(d.Name).
+		WithRule([]string{""}, []string{"persistentvolumes"}, []string{"get", "list", "watch", "create", "delete", "update", "patch"}).
+		WithRule([]string{""}, []string{"persistentvolumeclaims"}, []string{"get", "list", "watch", "update", "patch"}).
+		WithRule([]string{""}, []string{"persistentvolumeclaims/status"}, []string{"update", "patch"}).
+		WithRule([]string{""}, []string{"events"}, []string{"get", "list", "watch", "create", "update", "patch"}).
+		WithRule([]string{""}, []string{"nodes", "pods"}, []string{"get", "list", "watch"}).
+		WithRule([]string{"storage.k8s.io"}, []string{"storageclasses", "csinodes"}, []string{"get", "list", "watch"}).
+		WithRule([]string{"storage.k8s.io"}, []string{"volumeattachments"}, []string{"get", "list", "watch", "update", "patch"}).
+		WithRule([]string{"storage.k8s.io"}, []string{"volumeattachments/status"}, []string{"patch"})
+	if options.Snapshots {
+		role = role.
+			WithRule([]string{"snapshot.storage.k8s.io"}, []string{"volumesnapshotclasses", "volumesnapshots"}, []string{"get", "list", "watch"}).
+			WithRule([]string{"snapshot.storage.k8s.io"}, []string{"volumesnapshotcontents"}, []string{"get", "list", "watch", "create", "update", "delete", "patch"}).
+			WithRule([]string{"snapshot.storage.k8s.io"}, []string{"volumesnapshotcontents/status"}, []string{"update", "patch"})
+	}
+	if _, err := role.Create(f); err != nil {
+		return fmt.Errorf("error creating the cluster role of driver %s: %v", d.Name, err)
+	}
+	if _, err := builders.NewClusterRoleBinding(d.Name, d.Name).WithServiceAccount("", driverPodName).Create(f); err != nil {
+		return fmt.Errorf("error binding the cluster role of driver %s: %v", d.Name, err)
+	}
+	return nil
+}
+
+// createClusterObjects creates the CSIDriver object, the storage class and the
+// snapshot class of the driver. They are deleted by teardown.
+func (d *Driver) createClusterObjects(options Options) error {
+	f := d.f
+	csiDriver := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "storage.k8s.io/v1",
+		"kind":       "CSIDriver",
+		"metadata": map[string]interface{}{
+			"name":   d.Name,
+			"labels": stringMap(f.StandardLabels()),
+		},
+		"spec": map[string]interface{}{
+			"attachRequired":       options.AttachRequired,
+			"podInfoOnMount":       true,
+			"volumeLifecycleModes": []interface{}{"Persistent"},
+		},
+	}}
+	if _, err := f.DynamicClient.Resource(csiDriverResource).Create(csiDriver, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("error creating CSIDriver %s: %v", d.Name, err)
+	}
+
+	allowExpansion := !options.DisableControllerExpansion || !options.DisableNodeExpansion
+	class := &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: d.StorageClassName, Labels: f.StandardLabels()},
+		Provisioner:          d.Name,
+		AllowVolumeExpansion: &allowExpansion,
+	}
+	if _, err := f.ClientSet.StorageV1().StorageClasses().Create(class); err != nil {
+		return fmt.Errorf("error creating storage class %s: %v", d.StorageClassName, err)
+	}
+
+	if options.Snapshots {
+		snapshotClass := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshotClass",
+			"metadata": map[string]interface{}{
+				"name":   d.SnapshotClassName,
+				"labels": stringMap(f.StandardLabels()),
+			},
+			"driver":         d.Name,
+			"deletionPolicy": "Delete",
+		}}
+		if _, err := f.DynamicClient.Resource(volumeSnapshotClassResource).Create(snapshotClass, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("error creating volume snapshot class %s, are the snapshot CRDs installed: %v", d.SnapshotClassName, err)
+		}
+	}
+	return nil
+}
+
+// podSpec returns the pod of the driver, the mock and the sidecars sharing the
+// socket of the driver in the plugin directory of the kubelet.
+func (d *Driver) podSpec(options Options) *v1.Pod {
+	pluginDir := kubeletDir + "/plugins/" + d.Name
+	address := socketDir + "/csi.sock"
+	privileged := true
+	bidirectional := v1.MountPropagationBidirectional
+	directoryOrCreate := v1.HostPathDirectoryOrCreate
+	directory := v1.HostPathDirectory
+	socketMount := v1.VolumeMount{Name: "socket-dir", MountPath: socketDir}
+	sidecar := func(name, imageName string, args ...string) v1.Container {
+		return v1.Container{
+			Name:         name,
+			Image:        image.Get(imageName),
+			Args:         append([]string{"--csi-address=" + address, "--v=5"}, args...),
+			VolumeMounts: []v1.VolumeMount{socketMount},
+		}
+	}
+
+	mockArgs := []string{"--name=" + d.Name, "--permissive-target-path", "--hooks-file=" + hooksDir + "/" + hooksFile, "-v=5"}
+	if options.DisableControllerExpansion {
+		mockArgs = append(mockArgs, "--disable-controller-expansion")
+	}
+	if options.DisableNodeExpansion {
+		mockArgs = append(mockArgs, "--disable-node-expansion")
+	}
+	containers := []v1.Container{
+		{
+			Name:  mockContainer,
+			Image: image.Get(MockDriver),
+			Args:  mockArgs,
+			Env: []v1.EnvVar{
+				{Name: "CSI_ENDPOINT", Value: address},
+				{Name: "KUBE_NODE_NAME", ValueFrom: &v1.EnvVarSource{
+					FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+				}},
+			},
+			SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+			VolumeMounts: []v1.VolumeMount{
+				socketMount,
+				{Name: "hooks", MountPath: hooksDir},
+				{Name: "kubelet-dir", MountPath: kubeletDir, MountPropagation: &bidirectional},
+			},
+		},
+		sidecar("csi-provisioner", Provisioner),
+		sidecar("csi-resizer", Resizer),
+		{
+			Name:  "node-driver-registrar",
+			Image: image.Get(NodeDriverRegistrar),
+			Args:  []string{"--csi-address=" + address, "--kubelet-registration-path=" + pluginDir + "/csi.sock", "--v=5"},
+			VolumeMounts: []v1.VolumeMount{
+				socketMount,
+				{Name: "registration-dir", MountPath: "/registration"},
+			},
+		},
+	}
+	if options.AttachRequired {
+		containers = append(containers, sidecar("csi-attacher", Attacher))
+	}
+	if options.Snapshots {
+		containers = append(containers, sidecar("csi-snapshotter", Snapshotter))
+	}
+
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   driverPodName,
+			Labels: d.f.StandardLabels(),
+		},
+		Spec: v1.PodSpec{
+			ServiceAccountName: driverPodName,
+			NodeName:           options.NodeName,
+			Containers:         containers,
+			Volumes: []v1.Volume{
+				{Name: "socket-dir", VolumeSource: v1.VolumeSource{
+					HostPath: &v1.HostPathVolumeSource{Path: pluginDir, Type: &directoryOrCreate},
+				}},
+				{Name: "registration-dir", VolumeSource: v1.VolumeSource{
+					HostPath: &v1.HostPathVolumeSource{Path: kubeletDir + "/plugins_registry", Type: &directory},
+				}},
+				{Name: "kubelet-dir", VolumeSource: v1.VolumeSource{
+					HostPath: &v1.HostPathVolumeSource{Path: kubeletDir, Type: &directory},
+				}},
+				{Name: "hooks", VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: driverPodName}},
+				}},
+			},
+		},
+	}
+}
+
+// waitForRegistration waits for the kubelet of the node of the driver to list
+// it in its CSINode object, volumes can be staged once it does.
+func (d *Driver) waitForRegistration() error {
+	err := d.f.WaitUntil(d.f.Timeouts.PodStart, func() (bool, error) {
+		csiNode, err := d.f.DynamicClient.Resource(csiNodeResource).Get(d.NodeName, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				framework.Logf("Failed to get CSINode %s, retrying in %v: %v", d.NodeName, d.f.Timeouts.Poll, err)
+			}
+			return false, nil
+		}
+		drivers, _, _ := unstructured.NestedSlice(csiNode.Object, "spec", "drivers")
+		for _, driver := range drivers {
+			if m, ok := driver.(map[string]interface{}); ok && m["name"] == d.Name {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for driver %s to be registered on node %s: %v", d.Name, d.NodeName, err)
+	}
+	return nil
+}
+
+// teardown deletes the snapshots, the pods and the claims of the driver, so it
+// deletes their volumes while it runs, then its cluster objects. The driver
+// pod itself is deleted with the namespace.
+func (d *Driver) teardown() error {
+	f := d.f
+	namespace := f.Namespace.Name
+	if !framework.TestContext.DeleteNamespace {
+		framework.Logf("Found DeleteNamespace=false, keeping CSI driver %s and its volumes", d.Name)
+		return nil
+	}
+	var errs []string
+	if d.SnapshotClassName != "" {
+		if err := d.deleteSnapshots(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := d.deleteClaims(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if d.SnapshotClassName != "" {
+		if err := f.DynamicClient.Resource(volumeSnapshotClassResource).Delete(d.SnapshotClassName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Sprintf("error deleting volume snapshot class %s: %v", d.SnapshotClassName, err))
+		}
+	}
+	if err := f.ClientSet.StorageV1().StorageClasses().Delete(d.StorageClassName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, fmt.Sprintf("error deleting storage class %s: %v", d.StorageClassName, err))
+	}
+	if err := f.DynamicClient.Resource(csiDriverResource).Delete(d.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, fmt.Sprintf("error deleting CSIDriver %s: %v", d.Name, err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error tearing down CSI driver %s in %s: %s", d.Name, namespace, errs)
+	}
+	return nil
+}
+
+// deleteSnapshots deletes the snapshots of the snapshot class of the driver,
+// and waits for them to be gone.
+func (d *Driver) deleteSnapshots() error {
+	f := d.f
+	snapshots := f.DynamicClient.Resource(volumeSnapshotResource).Namespace(f.Namespace.Name)
+	list, err := snapshots.List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing volume snapshots: %v", err)
+	}
+	var names []string
+	for _, snapshot := range list.Items {
+		class, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+		if class != d.SnapshotClassName {
+			continue
+		}
+		if err := snapshots.Delete(snapshot.GetName(), &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting volume snapshot %s: %v", snapshot.GetName(), err)
+		}
+		names = append(names, snapshot.GetName())
+	}
+	return d.waitForDeletion("volume snapshots", names, func(name string) error {
+		_, err := snapshots.Get(name, metav1.GetOptions{})
+		return err
+	})
+}
+
+// deleteClaims deletes the claims of the storage class of the driver, and the
+// pods using them, and waits for their volumes to be deleted.
+func (d *Driver) deleteClaims() error {
+	f := d.f
+	namespace := f.Namespace.Name
+	claims, err := f.ClientSet.CoreV1().PersistentVolumeClaims(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing claims: %v", err)
+	}
+	driverClaims := map[string]bool{}
+	var volumes []string
+	for _, claim := range claims.Items {
+		if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != d.StorageClassName {
+			continue
+		}
+		driverClaims[claim.Name] = true
+		if claim.Spec.VolumeName != "" {
+			volumes = append(volumes, claim.Spec.VolumeName)
+		}
+	}
+	if len(driverClaims) == 0 {
+		return nil
+	}
+
+	pods, err := f.ClientSet.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && driverClaims[volume.PersistentVolumeClaim.ClaimName] {
+				if err := f.ClientSet.CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+					return fmt.Errorf("error deleting pod %s using a volume of the driver: %v", pod.Name, err)
+				}
+				break
+			}
+		}
+	}
+	for name := range driverClaims {
+		if err := f.ClientSet.CoreV1().PersistentVolumeClaims(namespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting claim %s: %v", name, err)
+		}
+	}
+	return d.waitForDeletion("volumes", volumes, func(name string) error {
+		_, err := f.ClientSet.CoreV1().PersistentVolumes().Get(name, metav1.GetOptions{})
+		return err
+	})
+}
+
+// waitForDeletion waits until get returns NotFound for every name.
+func (d *Driver) waitForDeletion(kind string, names []string, get func(name string) error) error {
+	var remaining []string
+	err := d.f.WaitUntil(d.f.Timeouts.ClaimBound, func() (bool, error) {
+		remaining = remaining[:0]
+		for _, name := range names {
+			if err := get(name); !apierrors.IsNotFound(err) {
+				remaining = append(remaining, name)
+			}
+		}
+		return len(remaining) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for the %s of driver %s to be deleted, %v remain: %v", kind, d.Name, remaining, err)
+	}
+	return nil
+}
+
+// stringMap converts labels for unstructured objects.
+func stringMap(m map[string]string) map[string]interface{} {
+	converted := map[string]interface{}{}
+	for k, v := range m {
+		converted[k] = v
+	}
+	return converted
+}
@@ -0,0 +1,106 @@
+package csimock
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Code is a gRPC status code, returned by the driver for the injected errors
+// and recorded with the calls.
+type Code int
+
+// The gRPC status codes.
+const (
+	CodeOK                 Code = 0
+	CodeCanceled           Code = 1
+	CodeUnknown            Code = 2
+	CodeInvalidArgument    Code = 3
+	CodeDeadlineExceeded   Code = 4
+	CodeNotFound           Code = 5
+	CodeAlreadyExists      Code = 6
+	CodePermissionDenied   Code = 7
+	CodeResourceExhausted  Code = 8
+	CodeFailedPrecondition Code = 9
+	CodeAborted            Code = 10
+	CodeOutOfRange         Code = 11
+	CodeUnimplemented      Code = 12
+	CodeInternal           Code = 13
+	CodeUnavailable        Code = 14
+)
+
+// faultMethods are the methods faults can be injected into.
+var faultMethods = map[string]bool{
+	"CreateVolume":              true,
+	"DeleteVolume":              true,
+	"ControllerPublishVolume":   true,
+	"ControllerUnpublishVolume": true,
+	"ControllerExpandVolume":    true,
+	"CreateSnapshot":            true,
+	"DeleteSnapshot":            true,
+	"NodeStageVolume":           true,
+	"NodeUnstageVolume":         true,
+	"NodePublishVolume":         true,
+	"NodeUnpublishVolume":       true,
+	"NodeExpandVolume":          true,
+}
+
+// Fault is an error, a latency, or both, injected into the calls of a method
+// of the driver.
+type Fault struct {
+	// Method is the CSI method, e.g. "NodePublishVolume".
+	Method string
+	// Code fails the calls with the code instead of running them, CodeOK
+	// runs them.
+	Code Code
+	// Latency delays the calls. The hooks of the mock run one at a time, the
+	// delayed calls block the other calls with faults.
+	Latency time.Duration
+	// Times is how many calls of the method get the fault, the first ones, 0
+	// for every call.
+	Times int
+}
+
+// globalsHook defines the state of the hooks, it is run once by the mock.
+const globalsHook = `var faultCalls = {};
+function sleep(ms) { var end = Date.now() + ms; while (Date.now() < end) {} }`
+
+// faultHooks returns the hooks file of the mock injecting the faults. The
+// start hook of a method, e.g. nodePublishVolumeStart, evaluates to the code
+// of the call, the first error of the faults of the method still applying.
+func faultHooks(faults []Fault) (string, error) {
+	scripts := map[string]*bytes.Buffer{}
+	for i, fault := range faults {
+		if !faultMethods[fault.Method] {
+			return "", fmt.Errorf("can't inject faults into CSI method %q", fault.Method)
+		}
+		hook := strings.ToLower(fault.Method[:1]) + fault.Method[1:] + "Start"
+		script, ok := scripts[hook]
+		if !ok {
+			script = bytes.NewBufferString("var code = 0;\n")
+			scripts[hook] = script
+		}
+		fmt.Fprintf(script, "faultCalls[%d] = (faultCalls[%d] || 0) + 1;\n", i, i)
+		fmt.Fprintf(script, "if (%d == 0 || faultCalls[%d] <= %d) {", fault.Times, i, fault.Times)
+		if fault.Latency > 0 {
+			fmt.Fprintf(script, " sleep(%d);", fault.Latency.Nanoseconds()/int64(time.Millisecond))
+		}
+		if fault.Code != CodeOK {
+			fmt.Fprintf(script, " if (code == 0) { code = %d; }", fault.Code)
+		}
+		fmt.Fprint(script, " }\n")
+	}
+
+	hooks := map[string]string{"globals": globalsHook}
+	for hook, script := range scripts {
+		hooks[hook] = script.String() + "code;\n"
+	}
+	data, err := yaml.Marshal(hooks)
+	if err != nil {
+		return "", fmt.Errorf("error encoding the hooks of the mock driver: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,104 @@
+package csimock
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestFaultHooks(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults []Fault
+		// want are the lines of the scripts of the hooks
+		want map[string][]string
+	}{
+		{
+			name:   "no faults",
+			faults: nil,
+			want:   map[string][]string{},
+		},
+		{
+			name:   "error",
+			faults: []Fault{{Method: "NodePublishVolume", Code: CodeUnavailable, Times: 2}},
+			want: map[string][]string{
+				"nodePublishVolumeStart": {
+					"var code = 0;",
+					"faultCalls[0] = (faultCalls[0] || 0) + 1;",
+					"if (2 == 0 || faultCalls[0] <= 2) { if (code == 0) { code = 14; } }",
+					"code;",
+				},
+			},
+		},
+		{
+			name:   "latency of every call",
+			faults: []Fault{{Method: "CreateVolume", Latency: 1500 * time.Millisecond}},
+			want: map[string][]string{
+				"createVolumeStart": {
+					"var code = 0;",
+					"faultCalls[0] = (faultCalls[0] || 0) + 1;",
+					"if (0 == 0 || faultCalls[0] <= 0) { sleep(1500); }",
+					"code;",
+				},
+			},
+		},
+		{
+			name: "faults of several methods",
+			faults: []Fault{
+				{Method: "CreateVolume", Code: CodeResourceExhausted, Latency: time.Second, Times: 1},
+				{Method: "NodeStageVolume", Code: CodeInternal},
+				{Method: "CreateVolume", Code: CodeAborted, Times: 3},
+			},
+			want: map[string][]string{
+				"createVolumeStart": {
+					"var code = 0;",
+					"faultCalls[0] = (faultCalls[0] || 0) + 1;",
+					"if (1 == 0 || faultCalls[0] <= 1) { sleep(1000); if (code == 0) { code = 8; } }",
+					"faultCalls[2] = (faultCalls[2] || 0) + 1;",
+					"if (3 == 0 || faultCalls[2] <= 3) { if (code == 0) { code = 10; } }",
+					"code;",
+				},
+				"nodeStageVolumeStart": {
+					"var code = 0;",
+					"faultCalls[1] = (faultCalls[1] || 0) + 1;",
+					"if (0 == 0 || faultCalls[1] <= 0) { if (code == 0) { code = 13; } }",
+					"code;",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		data, err := faultHooks(test.faults)
+		if err != nil {
+			t.Errorf("%s: faultHooks() failed: %v", test.name, err)
+			continue
+		}
+		hooks := map[string]string{}
+		if err := yaml.Unmarshal([]byte(data), &hooks); err != nil {
+			t.Errorf("%s: faultHooks() = %q isn't a hooks file: %v", test.name, data, err)
+			continue
+		}
+		if hooks["globals"] != globalsHook {
+			t.Errorf("%s: globals hook = %q, want %q", test.name, hooks["globals"], globalsHook)
+		}
+		delete(hooks, "globals")
+		if len(hooks) != len(test.want) {
+			t.Errorf("%s: faultHooks() has hooks %v, want %v", test.name, hooks, test.want)
+		}
+		for hook, lines := range test.want {
+			if got, want := hooks[hook], strings.Join(lines, "\n")+"\n"; got != want {
+				t.Errorf("%s: hook %s = %q, want %q", test.name, hook, got, want)
+			}
+		}
+	}
+}
+
+func TestFaultHooksUnknownMethod(t *testing.T) {
+	for _, method := range []string{"Probe", "NodeGetInfo", "nodePublishVolume", ""} {
+		if _, err := faultHooks([]Fault{{Method: method, Code: CodeInternal}}); err == nil {
+			t.Errorf("faultHooks() of method %q didn't fail", method)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zryfish/framework/framework/redact"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// ExecOptions are the options of a command run in a container.
+type ExecOptions struct {
+	Command []string
+
+	// Namespace defaults to the namespace of the framework.
+	Namespace     string
+	PodName       string
+	ContainerName string
+
+	// Stdin is sent to the command when set.
+	Stdin io.Reader
+	// Stdout receives the output of the command instead of the result when set.
+	Stdout io.Writer
+	// TTY allocates a terminal, stderr is then written to stdout.
+	TTY bool
+	// Timeout bounds the command, 0 for the spec context only.
+	Timeout time.Duration
+}
+
+// ExecResult is the output of a command run in a container.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExecWithOptions runs a command in a container through the pods/exec
+// subresource. A command exiting with a non zero code isn't an error, its code
+// is in the result. On timeout the connection is closed, the command may keep
+// running in the container.
+func (f *Framework) ExecWithOptions(options ExecOptions) (ExecResult, error) {
+	if options.Namespace == "" && f.Namespace != nil {
+		options.Namespace = f.Namespace.Name
+	}
+	Logf("Exec in %s/%s container %q: %s", options.Namespace, options.PodName, options.ContainerName, redact.String(strings.Join(options.Command, " ")))
+
+	config, err := f.ClientConfig()
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("error loading the client config: %v", err)
+	}
+	req := f.ClientSet.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(options.PodName).
+		Namespace(options.Namespace).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: options.ContainerName,
+			Command:   options.Command,
+			Stdin:     options.Stdin != nil,
+			Stdout:    true,
+			Stderr:    !options.TTY,
+			TTY:       options.TTY,
+		}, scheme.ParameterCodec)
+	// Stream takes no context: the requests of the executor use a context
+	// canceled on return, and its connection is closed on return, so the stream
+	// ends with the call
+	ctx, cancel := context.WithCancel(f.Context())
+	defer cancel()
+	config = restclient.CopyConfig(config)
+	withContext(config, func() context.Context { return ctx })
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("error creating the executor: %v", err)
+	}
+	conn := &closingUpgrader{Upgrader: upgrader}
+	defer conn.close()
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport, conn, "POST", req.URL())
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("error creating the executor: %v", err)
+	}
+
+	var stdout, stderr syncBuffer
+	streamOptions := remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Tty:    options.TTY,
+	}
+	if options.Stdin != nil {
+		// the stream reads stdin from a pipe closed on return, a read of
+		// options.Stdin which doesn't return keeps only the copy running
+		stdin, stdinWriter := io.Pipe()
+		defer stdin.CloseWithError(errExecReturned)
+		go func() {
+			_, err := io.Copy(stdinWriter, options.Stdin)
+			stdinWriter.CloseWithError(err)
+		}()
+		streamOptions.Stdin = stdin
+	}
+	if options.Stdout != nil {
+		streamOptions.Stdout = options.Stdout
+	}
+	if !options.TTY {
+		streamOptions.Stderr = &stderr
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(streamOptions)
+	}()
+	var timeout <-chan time.Time
+	if options.Timeout > 0 {
+		timer := time.NewTimer(options.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	result := func() ExecResult {
+		return ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	}
+	select {
+	case err = <-done:
+	case <-timeout:
+		return result(), fmt.Errorf("error running %q in %s/%s: timed out after %v", options.Command, options.Namespace, options.PodName, options.Timeout)
+	case <-f.Context().Done():
+		return result(), fmt.Errorf("error running %q in %s/%s: %v", options.Command, options.Namespace, options.PodName, f.Context().Err())
+	}
+
+	r := result()
+	if exitErr, ok := err.(utilexec.ExitError); ok && exitErr.Exited() {
+		r.ExitCode = exitErr.ExitStatus()
+		err = nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("error running %q in %s/%s: %v", options.Command, options.Namespace, options.PodName, err)
+	}
+	Logf("Exec exit code %d, stdout: %q, stderr: %q", r.ExitCode, redact.String(r.Stdout), redact.String(r.Stderr))
+	return r, nil
+}
+
+// ExecInContainer runs a command in a container of a pod of the framework namespace.
+func (f *Framework) ExecInContainer(podName, containerName string, command ...string) (ExecResult, error) {
+	return f.ExecWithOptions(ExecOptions{
+		Command:       command,
+		PodName:       podName,
+		ContainerName: containerName,
+	})
+}
+
+// ExecShellInContainer runs a shell command in a container of a pod of the framework namespace.
+func (f *Framework) ExecShellInContainer(podName, containerName string, command string) (ExecResult, error) {
+	return f.ExecInContainer(podName, containerName, "/bin/sh", "-c", command)
+}
+
+// ExecUntilOutputMatches runs a command until it exits with code 0 and its
+// stdout matches pattern, or timeout. Failed runs are retried, it returns the
+// result of the last run.
+func (f *Framework) ExecUntilOutputMatches(options ExecOptions, pattern *regexp.Regexp, timeout time.Duration) (ExecResult, error) {
+	var last ExecResult
+	var lastErr error
+	err := pollImmediate(f.Context(), f.Timeouts.Poll, timeout, func() (bool, error) {
+		last, lastErr = f.ExecWithOptions(options)
+		if lastErr != nil {
+			Logf("Exec failed, retrying in %v: %v", f.Timeouts.Poll, lastErr)
+			return false, nil
+		}
+		return last.ExitCode == 0 && pattern.MatchString(last.Stdout), nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return last, fmt.Errorf("error waiting for the output of %q to match %q: %v, last error: %v", options.Command, pattern, err, lastErr)
+		}
+		return last, fmt.Errorf("error waiting for the output of %q to match %q: %v, last exit code %d and stdout %q", options.Command, pattern, err, last.ExitCode, redact.String(last.Stdout))
+	}
+	return last, nil
+}
+
+// errExecReturned ends the reads of the stdin of a stream once the exec returned.
+var errExecReturned = errors.New("exec returned")
+
+// closingUpgrader records the SPDY connection of an exec, to close it once
+// the exec returns, and closes the connections made after.
+type closingUpgrader struct {
+	spdy.Upgrader
+
+	lock   sync.Mutex
+	conn   httpstream.Connection
+	closed bool
+}
+
+func (u *closingUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.closed {
+		conn.Close()
+		return nil, errExecReturned
+	}
+	u.conn = conn
+	return conn, nil
+}
+
+func (u *closingUpgrader) close() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.closed = true
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+// syncBuffer is a buffer written by a stream which may be abandoned.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
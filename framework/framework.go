@@ -1,16 +1,21 @@
 package framework
 
 import (
+    "context"
     "fmt"
     "github.com/onsi/ginkgo"
     "github.com/onsi/gomega"
     "k8s.io/apimachinery/pkg/api/errors"
     "k8s.io/apimachinery/pkg/runtime/schema"
+    "os"
+    "path/filepath"
     "strings"
+    "sync"
 
     "k8s.io/api/core/v1"
     "k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
 )
 
 type Framework struct {
@@ -18,6 +23,7 @@ type Framework struct {
 
 	// ClientSet uses internal objects, you should use ClientSet where possible.
 	ClientSet  clientset.Interface
+	// DynamicClient reads and writes the objects this clientset has no types for, e.g. CSIDrivers.
 	DynamicClient dynamic.Interface
 
 	// configuration for framework's client
@@ -26,6 +32,31 @@ type Framework struct {
 
 	Namespace          *v1.Namespace
 	namespacesToDelete []*v1.Namespace
+	// monitors are stopped, then portForwards closed, in AfterEach.
+	monitors     []*AvailabilityMonitor
+	portForwards []*PortForward
+	// cleanups are run in AfterEach, in reverse order.
+	cleanups []func() error
+	// podMutators mutate the pods created in the running spec.
+	podMutators []PodSpecMutator
+
+	// clientConfig is the config of the framework clients, nil when the clientset was given.
+	clientConfig *restclient.Config
+
+	// Timeouts are the timeouts of the framework waits, NewTimeouts() unless set.
+	Timeouts *Timeouts
+
+	// lock guards ctx and the namespaces, used by CleanupActiveNamespaces on interrupts.
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	// cleanupCtx is the context of the requests of the clients while
+	// CleanupActiveNamespaces cleans up after the spec, nil otherwise.
+	cleanupCtx context.Context
+
+	// Attempt is the attempt number of the running spec, failed specs are re-run when retries are enabled.
+	Attempt  int
+	attempts map[string]int
 }
 
 type Options struct {
@@ -48,6 +79,7 @@ func NewFramework(baseName string, options Options, client clientset.Interface)
         BaseName: baseName,
         ClientSet: client,
         Options: options,
+        attempts: map[string]int{},
     }
 
     ginkgo.BeforeEach(f.BeforeEach)
@@ -58,17 +90,48 @@ func NewFramework(baseName string, options Options, client clientset.Interface)
 
 // BeforeEach gets a clientset and makes a namespace
 func (f *Framework) BeforeEach() {
+    desc := ginkgo.CurrentGinkgoTestDescription()
+    spec := fmt.Sprintf("%s@%s:%d", desc.FullTestText, desc.FileName, desc.LineNumber)
+    f.attempts[spec]++
+    f.Attempt = f.attempts[spec]
+    if f.Attempt > 1 {
+        Logf("Retrying spec, attempt %d", f.Attempt)
+    }
+
+    if f.Timeouts == nil {
+        f.Timeouts = NewTimeouts()
+    }
+
+    f.lock.Lock()
+    if f.Timeouts.Spec > 0 {
+        f.ctx, f.cancel = context.WithTimeout(suiteContext, f.Timeouts.Spec)
+    } else {
+        f.ctx, f.cancel = context.WithCancel(suiteContext)
+    }
+    f.lock.Unlock()
+    activeLock.Lock()
+    activeFrameworks[f] = true
+    activeLock.Unlock()
+
     if f.ClientSet == nil {
         ginkgo.By("Creating a kubernetes client")
         config, err := LoadConfig()
         gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        withContext(config, f.requestContext)
         f.ClientSet, err = clientset.NewForConfig(config)
         gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        f.clientConfig = config
+    }
+    if f.DynamicClient == nil {
+        config, err := f.ClientConfig()
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
+        f.DynamicClient, err = dynamic.NewForConfig(config)
+        gomega.Expect(err).NotTo(gomega.HaveOccurred())
     }
 
     if !f.SkipNamespaceCreation {
         ns, err := f.CreateNamespace(f.BaseName, map[string]string{
-            "e2e-framework": f.BaseName,
+            FrameworkLabel: f.BaseName,
         })
         gomega.Expect(err).NotTo(gomega.HaveOccurred(), "failed to create namespace")
         ginkgo.By(fmt.Sprintf("Create namespace %s successfully", ns.Name))
@@ -78,13 +141,63 @@ func (f *Framework) BeforeEach() {
 }
 
 func (f *Framework) AfterEach()  {
+    // the spec is over, the cleanup must not be canceled with it
+    f.lock.Lock()
+    if f.cancel != nil {
+        f.cancel()
+    }
+    f.ctx, f.cancel = context.WithCancel(context.Background())
+    f.lock.Unlock()
+
     defer func() {
+        defer func() {
+            f.cancel()
+            activeLock.Lock()
+            delete(activeFrameworks, f)
+            activeLock.Unlock()
+        }()
+
+        f.lock.Lock()
+        monitors := f.monitors
+        f.monitors = nil
+        f.lock.Unlock()
+        for _, m := range monitors {
+            m.Stop()
+        }
+
+        f.lock.Lock()
+        for _, pf := range f.portForwards {
+            pf.Close()
+        }
+        f.portForwards = nil
+        cleanups := f.cleanups
+        f.cleanups = nil
+        f.podMutators = nil
+        f.lock.Unlock()
+        for i := len(cleanups) - 1; i >= 0; i-- {
+            if err := cleanups[i](); err != nil {
+                Logf("Failed to clean up: %v", err)
+            }
+        }
+
         nsDeletionErrors := map[string]error{}
 
+        // keep what the namespaces looked like, every failed attempt has its own artifacts
+        if ginkgo.CurrentGinkgoTestDescription().Failed && f.ClientSet != nil {
+            if dir := f.ArtifactsDir(); dir != "" {
+                for _, ns := range f.namespacesToDelete {
+                    if err := DumpNamespaceInfo(f.ClientSet, ns.Name, dir); err != nil {
+                        Logf("Failed to dump namespace %s: %v", ns.Name, err)
+                    }
+                }
+                Logf("Artifacts of attempt %d saved in %s", f.Attempt, dir)
+            }
+        }
+
         if TestContext.DeleteNamespace && (TestContext.DeleteNamespaceOnFailure || !ginkgo.CurrentGinkgoTestDescription().Failed) {
             for _, ns := range f.namespacesToDelete {
                 ginkgo.By(fmt.Sprintf("Destroying namespace %q for this suite", ns.Name))
-                if err := deleteNS(f.ClientSet, f.DynamicClient, ns.Name, DefaultNamespaceDeletionTimeout); err != nil {
+                if err := deleteNS(f.Context(), f.ClientSet, f.DynamicClient, ns.Name, f.Timeouts); err != nil {
                     if !errors.IsNotFound(err) {
                         nsDeletionErrors[ns.Name] = err
                     } else {
@@ -100,29 +213,117 @@ func (f *Framework) AfterEach()  {
             }
         }
 
+        f.lock.Lock()
         f.Namespace = nil
         f.ClientSet = nil
+        f.DynamicClient = nil
         f.namespacesToDelete = nil
+        f.lock.Unlock()
 
         if len(nsDeletionErrors) > 0 {
             messages := []string{}
             for namespaceKey, namespaceErr := range nsDeletionErrors {
                 messages = append(messages, fmt.Sprintf("Couldn't delete ns: %q: %s (%#v)", namespaceKey, namespaceErr, namespaceErr))
             }
-            ginkgo.Fail(strings.Join(messages, ","))
+            Failf("%s", strings.Join(messages, ","))
         }
     }()
 }
 
 func (f *Framework) CreateNamespace(baseName string, labels map[string]string) (*v1.Namespace, error) {
-    ns, err := CreateTestingNS(f.BaseName, f.ClientSet, labels)
+    ns, err := createTestingNS(f.Context(), f.BaseName, f.ClientSet, labels, f.Timeouts)
 
     // check ns instead of error or see if its nil as we may
     // fail to create serviceaccount in it.
     // In this case. we should not forget to delete the namespace
     if ns != nil {
+        f.lock.Lock()
         f.namespacesToDelete = append(f.namespacesToDelete, ns)
+        f.lock.Unlock()
     }
     return ns, err
 }
 
+// Context returns the context of the running spec, canceled when the spec ends,
+// times out or the run is interrupted. Requests of the framework clients use it,
+// see requestContext.
+func (f *Framework) Context() context.Context {
+    f.lock.Lock()
+    defer f.lock.Unlock()
+    if f.ctx == nil {
+        return suiteContext
+    }
+    return f.ctx
+}
+
+// requestContext returns the context of the requests of the framework clients,
+// the context of the spec unless the spec is cleaned up after an interrupt.
+func (f *Framework) requestContext() context.Context {
+    f.lock.Lock()
+    cleanupCtx := f.cleanupCtx
+    f.lock.Unlock()
+    if cleanupCtx != nil {
+        return cleanupCtx
+    }
+    return f.Context()
+}
+
+// StandardLabels returns the labels of the objects created by the framework, with the run id and the base name.
+func (f *Framework) StandardLabels() map[string]string {
+    return map[string]string{
+        RunLabel:       string(RunId),
+        FrameworkLabel: f.BaseName,
+    }
+}
+
+// AddCleanup registers a func run in AfterEach, before the namespaces are
+// deleted, e.g. to delete cluster scoped objects. Errors are logged.
+func (f *Framework) AddCleanup(cleanup func() error) {
+    f.lock.Lock()
+    defer f.lock.Unlock()
+    f.cleanups = append(f.cleanups, cleanup)
+}
+
+// ClientConfig returns the config of the framework clients, loaded with
+// LoadConfig when the framework was given a clientset.
+func (f *Framework) ClientConfig() (*restclient.Config, error) {
+    if f.clientConfig == nil {
+        config, err := LoadConfig()
+        if err != nil {
+            return nil, err
+        }
+        withContext(config, f.requestContext)
+        f.clientConfig = config
+    }
+    return f.clientConfig, nil
+}
+
+// ArtifactsDir returns the directory where the artifacts of the current attempt of the
+// running spec are stored, creating it if needed. It returns "" when no report directory is set.
+func (f *Framework) ArtifactsDir() string {
+    dir := SpecArtifactsDir(ginkgo.CurrentGinkgoTestDescription().FullTestText, f.Attempt)
+    if dir == "" {
+        return ""
+    }
+    if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+        Logf("Failed to create artifacts directory %s: %v", dir, err)
+        return ""
+    }
+    return dir
+}
+
+// SpecArtifactsDir returns the directory of the artifacts of an attempt of a spec.
+func SpecArtifactsDir(spec string, attempt int) string {
+    if TestContext.ReportDir == "" {
+        return ""
+    }
+    return filepath.Join(TestContext.ReportDir, "artifacts", SanitizeFileName(spec), fmt.Sprintf("attempt-%d", attempt))
+}
+
+// SpecLogFile returns the file where the output of a spec run on a ginkgo node is written.
+func SpecLogFile(spec string, node int) string {
+    if TestContext.ReportDir == "" {
+        return ""
+    }
+    return filepath.Join(TestContext.ReportDir, "logs", fmt.Sprintf("%s_node-%02d.log", SanitizeFileName(spec), node))
+}
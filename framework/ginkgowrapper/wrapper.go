@@ -4,10 +4,12 @@ import (
     "bufio"
     "bytes"
     "github.com/onsi/ginkgo"
+    "io"
     "regexp"
     "runtime"
     "runtime/debug"
     "strings"
+    "sync"
 )
 
 type FailurePanic struct {
@@ -39,6 +41,10 @@ func Fail(message string, callerSkip ...int) {
         FullStackTrace: pruneStack(skip),
     }
 
+    for _, handler := range failureHandlers {
+        handler(fp)
+    }
+
     defer func() {
         e := recover()
         if e != nil {
@@ -49,6 +55,14 @@ func Fail(message string, callerSkip ...int) {
     ginkgo.Fail(message, skip)
 }
 
+var failureHandlers []func(FailurePanic)
+
+// OnFailure registers a function called with the details of every failure
+// raised through Fail, before ginkgo is notified of it.
+func OnFailure(handler func(FailurePanic)) {
+    failureHandlers = append(failureHandlers, handler)
+}
+
 // SkipPanic is the value that will be panicked from Skip.
 type SkipPanic struct {
     Message        string // The failure message passed to Fail
@@ -93,7 +107,16 @@ var stackSkipPattern = regexp.MustCompile(`onsi/ginkgo`)
 
 func pruneStack(skip int) string {
     skip += 2 // one for pruneStack and one for debug.Stack
-    stack := debug.Stack()
+    return prune(debug.Stack(), skip)
+}
+
+// PruneStack filters the ginkgo frames out of a stack trace formatted like
+// the ones returned by runtime/debug.Stack.
+func PruneStack(stack []byte) string {
+    return prune(stack, 0)
+}
+
+func prune(stack []byte, skip int) string {
     scanner := bufio.NewScanner(bytes.NewBuffer(stack))
     var prunedStack []string
 
@@ -113,4 +136,34 @@ func pruneStack(skip int) string {
     }
 
     return strings.Join(prunedStack, "\n")
-}
\ No newline at end of file
+}
+
+// writerTee copies what is written to GinkgoWriter to other writers.
+type writerTee struct {
+    lock    sync.Mutex
+    writers []io.Writer
+}
+
+func (t *writerTee) Write(b []byte) (int, error) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+    for _, w := range t.writers {
+        w.Write(b)
+    }
+    return len(b), nil
+}
+
+var tee = &writerTee{}
+
+// TeeGinkgoWriter copies everything written to GinkgoWriter to w, in addition
+// to what ginkgo does with it.
+func TeeGinkgoWriter(w io.Writer) {
+    tee.lock.Lock()
+    defer tee.lock.Unlock()
+    if len(tee.writers) == 0 {
+        if redirector, ok := ginkgo.GinkgoWriter.(interface{ AndRedirectTo(io.Writer) }); ok {
+            redirector.AndRedirectTo(tee)
+        }
+    }
+    tee.writers = append(tee.writers, w)
+}
@@ -0,0 +1,99 @@
+package history
+
+import (
+	"sort"
+)
+
+// maxBaselineRuns is how many of the latest passing runs make the duration baseline of a spec.
+const maxBaselineRuns = 10
+
+// Regression is a spec that became slower than its history.
+type Regression struct {
+	Spec     string
+	Baseline float64
+	Duration float64
+}
+
+// Comparison is the difference between a run and the history of its specs.
+type Comparison struct {
+	// NewFailures failed in the run, but passed the last time they ran or never ran before.
+	NewFailures []Record
+	// Fixed passed in the run, but failed the last time they ran.
+	Fixed []Record
+	// Regressions took longer than their baseline beyond the threshold.
+	Regressions []Regression
+}
+
+// Empty returns true if the comparison found nothing to report.
+func (c *Comparison) Empty() bool {
+	return len(c.NewFailures) == 0 && len(c.Fixed) == 0 && len(c.Regressions) == 0
+}
+
+// Compare compares a run with the history of its specs. Records of the same run
+// found in the history are ignored. A spec regresses when it takes more than
+// (1+threshold) times its baseline, the median duration of its latest passing
+// runs, and at least minDelta seconds more. Flaky runs aren't checked for
+// regressions, the reports of earlier versions give them the time of all
+// their attempts.
+func Compare(history map[string][]Record, run []Record, threshold, minDelta float64) *Comparison {
+	c := &Comparison{}
+	for _, r := range run {
+		if !r.Ran() || r.Status == StatusQuarantined {
+			continue
+		}
+
+		var previous []Record
+		for _, h := range history[r.Spec] {
+			if h.RunId != r.RunId && h.Ran() && h.Status != StatusQuarantined {
+				previous = append(previous, h)
+			}
+		}
+
+		if !r.Succeeded() {
+			if len(previous) == 0 || previous[len(previous)-1].Succeeded() {
+				c.NewFailures = append(c.NewFailures, r)
+			}
+			continue
+		}
+
+		if len(previous) > 0 && !previous[len(previous)-1].Succeeded() {
+			c.Fixed = append(c.Fixed, r)
+		}
+
+		if r.Status == StatusFlaky {
+			continue
+		}
+		if baseline, ok := baselineDuration(previous); ok {
+			if r.Duration > baseline*(1+threshold) && r.Duration-baseline >= minDelta {
+				c.Regressions = append(c.Regressions, Regression{Spec: r.Spec, Baseline: baseline, Duration: r.Duration})
+			}
+		}
+	}
+
+	sort.Slice(c.NewFailures, func(i, j int) bool { return c.NewFailures[i].Spec < c.NewFailures[j].Spec })
+	sort.Slice(c.Fixed, func(i, j int) bool { return c.Fixed[i].Spec < c.Fixed[j].Spec })
+	sort.Slice(c.Regressions, func(i, j int) bool {
+		return c.Regressions[i].Duration/c.Regressions[i].Baseline > c.Regressions[j].Duration/c.Regressions[j].Baseline
+	})
+	return c
+}
+
+// baselineDuration returns the median duration of the latest passing records.
+func baselineDuration(records []Record) (float64, bool) {
+	var durations []float64
+	for i := len(records) - 1; i >= 0 && len(durations) < maxBaselineRuns; i-- {
+		if records[i].Status == StatusPassed {
+			durations = append(durations, records[i].Duration)
+		}
+	}
+	if len(durations) == 0 {
+		return 0, false
+	}
+
+	sort.Float64s(durations)
+	middle := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[middle-1] + durations[middle]) / 2, true
+	}
+	return durations[middle], true
+}
@@ -0,0 +1,180 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+)
+
+func record(runId, spec, status string, duration float64) Record {
+	return Record{RunId: runId, Spec: spec, Status: status, Duration: duration}
+}
+
+func specs(records []Record) []string {
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Spec)
+	}
+	return names
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     []Record
+		run         []Record
+		newFailures []string
+		fixed       []string
+		regressions []Regression
+	}{
+		{
+			name:        "failure of a new spec",
+			run:         []Record{record("2", "a", StatusFailed, 1)},
+			newFailures: []string{"a"},
+		},
+		{
+			name:        "failure after a pass",
+			history:     []Record{record("1", "a", StatusPassed, 1)},
+			run:         []Record{record("2", "a", StatusFailed, 1)},
+			newFailures: []string{"a"},
+		},
+		{
+			name:    "failure after a failure",
+			history: []Record{record("1", "a", StatusPassed, 1), record("2", "a", StatusFailed, 1)},
+			run:     []Record{record("3", "a", StatusFailed, 1)},
+		},
+		{
+			name:    "failure after a skip of a failed spec",
+			history: []Record{record("1", "a", StatusFailed, 1), record("2", "a", StatusSkipped, 0)},
+			run:     []Record{record("3", "a", StatusFailed, 1)},
+		},
+		{
+			name:    "pass after a failure",
+			history: []Record{record("1", "a", StatusFailed, 1)},
+			run:     []Record{record("2", "a", StatusPassed, 1)},
+			fixed:   []string{"a"},
+		},
+		{
+			name:    "flaky after a failure",
+			history: []Record{record("1", "a", StatusFailed, 1)},
+			run:     []Record{record("2", "a", StatusFlaky, 1)},
+			fixed:   []string{"a"},
+		},
+		{
+			name:        "regression",
+			history:     []Record{record("1", "a", StatusPassed, 10), record("2", "a", StatusPassed, 12), record("3", "a", StatusPassed, 11)},
+			run:         []Record{record("4", "a", StatusPassed, 20)},
+			regressions: []Regression{{Spec: "a", Baseline: 11, Duration: 20}},
+		},
+		{
+			name:    "within the threshold",
+			history: []Record{record("1", "a", StatusPassed, 10)},
+			run:     []Record{record("2", "a", StatusPassed, 15)},
+		},
+		{
+			name:    "below the minimum delta",
+			history: []Record{record("1", "a", StatusPassed, 1)},
+			run:     []Record{record("2", "a", StatusPassed, 3)},
+		},
+		{
+			name:    "flaky run taking longer",
+			history: []Record{record("1", "a", StatusPassed, 10)},
+			run:     []Record{record("2", "a", StatusFlaky, 20)},
+		},
+		{
+			name:        "baseline of passed runs only",
+			history:     []Record{record("1", "a", StatusPassed, 10), record("2", "a", StatusFlaky, 30), record("3", "a", StatusFailed, 30)},
+			run:         []Record{record("4", "a", StatusPassed, 25)},
+			fixed:       []string{"a"},
+			regressions: []Regression{{Spec: "a", Baseline: 10, Duration: 25}},
+		},
+		{
+			name:        "records of the same run",
+			history:     []Record{record("1", "a", StatusPassed, 1), record("2", "a", StatusFailed, 1), record("2", "b", StatusPassed, 1)},
+			run:         []Record{record("2", "a", StatusFailed, 1), record("2", "b", StatusPassed, 30)},
+			newFailures: []string{"a"},
+		},
+		{
+			name:    "quarantined and skipped specs",
+			history: []Record{record("1", "a", StatusPassed, 1)},
+			run:     []Record{record("2", "a", StatusQuarantined, 1), record("2", "b", StatusSkipped, 0)},
+		},
+		{
+			name:        "sorted",
+			history:     []Record{record("1", "c", StatusPassed, 10), record("1", "d", StatusPassed, 10)},
+			run:         []Record{record("2", "b", StatusFailed, 1), record("2", "a", StatusFailed, 1), record("2", "c", StatusPassed, 20), record("2", "d", StatusPassed, 40)},
+			newFailures: []string{"a", "b"},
+			regressions: []Regression{{Spec: "d", Baseline: 10, Duration: 40}, {Spec: "c", Baseline: 10, Duration: 20}},
+		},
+	}
+	for _, test := range tests {
+		history := map[string][]Record{}
+		for _, r := range test.history {
+			history[r.Spec] = append(history[r.Spec], r)
+		}
+		c := Compare(history, test.run, 0.5, 5)
+		if got := specs(c.NewFailures); !reflect.DeepEqual(got, test.newFailures) {
+			t.Errorf("%s: new failures = %v, want %v", test.name, got, test.newFailures)
+		}
+		if got := specs(c.Fixed); !reflect.DeepEqual(got, test.fixed) {
+			t.Errorf("%s: fixed = %v, want %v", test.name, got, test.fixed)
+		}
+		if !reflect.DeepEqual(c.Regressions, test.regressions) {
+			t.Errorf("%s: regressions = %+v, want %+v", test.name, c.Regressions, test.regressions)
+		}
+		if empty := test.newFailures == nil && test.fixed == nil && test.regressions == nil; c.Empty() != empty {
+			t.Errorf("%s: Empty() = %v, want %v", test.name, c.Empty(), empty)
+		}
+	}
+}
+
+func TestBaselineDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []Record
+		want    float64
+		ok      bool
+	}{
+		{name: "no records"},
+		{
+			name:    "no passed records",
+			records: []Record{record("1", "a", StatusFailed, 1), record("2", "a", StatusFlaky, 2)},
+		},
+		{
+			name:    "odd",
+			records: []Record{record("1", "a", StatusPassed, 3), record("2", "a", StatusPassed, 1), record("3", "a", StatusPassed, 2)},
+			want:    2,
+			ok:      true,
+		},
+		{
+			name:    "even",
+			records: []Record{record("1", "a", StatusPassed, 4), record("2", "a", StatusPassed, 1), record("3", "a", StatusPassed, 2), record("4", "a", StatusPassed, 10)},
+			want:    3,
+			ok:      true,
+		},
+		{
+			name:    "passed only",
+			records: []Record{record("1", "a", StatusPassed, 2), record("2", "a", StatusFlaky, 100), record("3", "a", StatusFailed, 100)},
+			want:    2,
+			ok:      true,
+		},
+		{
+			// the two oldest records are past the latest maxBaselineRuns
+			name: "latest runs",
+			records: []Record{
+				record("1", "a", StatusPassed, 1), record("2", "a", StatusPassed, 1),
+				record("3", "a", StatusPassed, 100), record("4", "a", StatusPassed, 100), record("5", "a", StatusPassed, 100),
+				record("6", "a", StatusPassed, 100), record("7", "a", StatusPassed, 100), record("8", "a", StatusPassed, 1),
+				record("9", "a", StatusPassed, 1), record("10", "a", StatusPassed, 1), record("11", "a", StatusPassed, 1),
+				record("12", "a", StatusPassed, 100),
+			},
+			want: 100,
+			ok:   true,
+		},
+	}
+	for _, test := range tests {
+		got, ok := baselineDuration(test.records)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: baselineDuration() = %v, %v, want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/zryfish/framework/framework/junit"
+)
+
+// Status of a spec in a run.
+const (
+	StatusPassed      = "passed"
+	StatusFailed      = "failed"
+	StatusFlaky       = "flaky"
+	StatusSkipped     = "skipped"
+	StatusQuarantined = "quarantined"
+)
+
+// Record is the result of one spec in one run.
+type Record struct {
+	RunId     string  `json:"runId"`
+	Timestamp string  `json:"timestamp"`
+	Spec      string  `json:"spec"`
+	Status    string  `json:"status"`
+	Duration  float64 `json:"duration"`
+}
+
+// Ran returns true if the spec actually ran.
+func (r Record) Ran() bool {
+	return r.Status != StatusSkipped
+}
+
+// Succeeded returns true if the spec eventually passed.
+func (r Record) Succeeded() bool {
+	return r.Status == StatusPassed || r.Status == StatusFlaky
+}
+
+// FromSuite turns the results of a run into records. The run is identified by
+// the RunId property of the report, or by its timestamp if it has none.
+func FromSuite(suite *junit.TestSuite) []Record {
+	runId, ok := suite.Property("RunId")
+	if !ok || runId == "" {
+		runId = suite.Timestamp
+	}
+
+	var records []Record
+	for i := range suite.TestCases {
+		tc := &suite.TestCases[i]
+		records = append(records, Record{
+			RunId:     runId,
+			Timestamp: suite.Timestamp,
+			Spec:      tc.Name,
+			Status:    status(tc),
+			Duration:  tc.Time,
+		})
+	}
+	return records
+}
+
+func status(tc *junit.TestCase) string {
+	switch {
+	case tc.Failed():
+		return StatusFailed
+	case tc.Status == junit.StatusQuarantined:
+		return StatusQuarantined
+	case tc.Skipped != nil:
+		return StatusSkipped
+	case tc.IsFlaky():
+		return StatusFlaky
+	default:
+		return StatusPassed
+	}
+}
+
+// Store is a file of records, one JSON document per line.
+type Store struct {
+	path string
+}
+
+// NewStore returns the store kept in path. The file is created on first append.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load reads every record of the store, grouped by spec and ordered by run timestamp.
+func (s *Store) Load() (map[string][]Record, error) {
+	history := map[string][]Record{}
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("error parsing %s line %d: %v", s.path, line, err)
+		}
+		history[r.Spec] = append(history[r.Spec], r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for spec := range history {
+		records := history[spec]
+		sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp < records[j].Timestamp })
+	}
+	return history, nil
+}
+
+// HasRun returns true if records of the run are already in the store.
+func (s *Store) HasRun(runId string) (bool, error) {
+	history, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	for _, records := range history {
+		for _, r := range records {
+			if r.RunId == runId {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Append adds records to the store.
+func (s *Store) Append(records []Record) error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,111 @@
+// Package image is the registry of the images run by the specs. Specs refer to
+// images by name, e.g. image.Get(image.Nginx), so versions are kept in one
+// place and registries can be remapped to mirrors, e.g. in offline networks.
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Names of the images of the framework.
+const (
+	// Agnhost serves and probes connections, see its subcommands.
+	Agnhost = "agnhost"
+	Busybox = "busybox"
+	Nginx   = "nginx"
+	Pause   = "pause"
+)
+
+var (
+	lock sync.RWMutex
+	// images are the references of the images by name, before remapping.
+	images = map[string]string{
+		Agnhost: "k8s.gcr.io/e2e-test-images/agnhost:2.32",
+		Busybox: "docker.io/library/busybox:1.31",
+		Nginx:   "docker.io/library/nginx:1.17-alpine",
+		Pause:   "k8s.gcr.io/pause:3.1",
+	}
+	// mirrors maps registries, or repository prefixes, to their mirror.
+	mirrors = map[string]string{}
+)
+
+// Register adds an image, or changes the reference of an image, e.g. for the
+// images of a suite. It must be called before the specs run.
+func Register(name, reference string) {
+	lock.Lock()
+	defer lock.Unlock()
+	images[name] = Normalize(reference)
+}
+
+// Get returns the reference of an image, remapped to its mirror. It panics on
+// unknown names, which are bugs of the specs.
+func Get(name string) string {
+	lock.RLock()
+	defer lock.RUnlock()
+	reference, ok := images[name]
+	if !ok {
+		panic(fmt.Sprintf("unknown image %q, register it with image.Register", name))
+	}
+	return remap(reference)
+}
+
+// All returns the references of all the images, remapped to their mirrors and sorted.
+func All() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	var references []string
+	for _, reference := range images {
+		references = append(references, remap(reference))
+	}
+	sort.Strings(references)
+	return references
+}
+
+// SetMirrors sets the mirrors of registries or repository prefixes, e.g.
+// "docker.io/library": "mirror.local:5000/library" or "k8s.gcr.io":
+// "mirror.local:5000/k8s". The longest matching prefix is used.
+func SetMirrors(m map[string]string) error {
+	normalized := map[string]string{}
+	for from, to := range m {
+		from, to = strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/")
+		if from == "" || to == "" {
+			return fmt.Errorf("invalid image mirror %q: %q, registries must not be empty", from, to)
+		}
+		normalized[from] = to
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	mirrors = normalized
+	return nil
+}
+
+// remap returns the reference on the mirror of its longest matching prefix.
+func remap(reference string) string {
+	longest := ""
+	for from := range mirrors {
+		if strings.HasPrefix(reference, from+"/") && len(from) > len(longest) {
+			longest = from
+		}
+	}
+	if longest == "" {
+		return reference
+	}
+	return mirrors[longest] + strings.TrimPrefix(reference, longest)
+}
+
+// Normalize returns the full reference of an image, with its registry, e.g.
+// docker.io/library/nginx:1.17 for nginx:1.17.
+func Normalize(reference string) string {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) == 1 {
+		return "docker.io/library/" + reference
+	}
+	// the first part is a registry if it looks like a host
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return reference
+	}
+	return "docker.io/" + reference
+}
@@ -0,0 +1,92 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/zryfish/framework/framework/image"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// PullSecretName is the image pull secret created in the test namespaces when
+// the images section of the config file has a pull secret file.
+const PullSecretName = "e2e-image-pull"
+
+// imageSettings is the images section of the config file, e.g.
+//
+//	images:
+//	  mirrors:
+//	    docker.io/library: mirror.local:5000/library
+//	    k8s.gcr.io: mirror.local:5000/k8s
+//	  pullSecretFile: /etc/e2e/mirror-auth.json
+type imageSettings struct {
+	// Mirrors remaps registries, or repository prefixes, see image.SetMirrors.
+	Mirrors map[string]string `json:"mirrors"`
+	// PullSecretFile is a docker config JSON file with the credentials of the
+	// mirrors, used by every pod the framework creates.
+	PullSecretFile string `json:"pullSecretFile"`
+}
+
+var (
+	// imageConfig is decoded from the config file.
+	imageConfig imageSettings
+	// pullSecret is the content of the pull secret file.
+	pullSecret []byte
+)
+
+// applyImageConfig remaps the images and loads the pull secret file.
+func applyImageConfig(settings imageSettings) error {
+	if err := image.SetMirrors(settings.Mirrors); err != nil {
+		return err
+	}
+	if settings.PullSecretFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(settings.PullSecretFile)
+	if err != nil {
+		return fmt.Errorf("error reading the image pull secret file: %v", err)
+	}
+	var config struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil || len(config.Auths) == 0 {
+		return fmt.Errorf("image pull secret file %s must be a docker config JSON file with auths", settings.PullSecretFile)
+	}
+	pullSecret = data
+	return nil
+}
+
+// createPullSecret creates the image pull secret in a namespace. The pods are
+// given it by addPullSecret, whatever their service account.
+func createPullSecret(c clientset.Interface, namespace string) error {
+	if pullSecret == nil {
+		return nil
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: PullSecretName},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{v1.DockerConfigJsonKey: pullSecret},
+	}
+	if _, err := c.CoreV1().Secrets(namespace).Create(secret); err != nil {
+		return fmt.Errorf("error creating the image pull secret in namespace %s: %v", namespace, err)
+	}
+	return nil
+}
+
+// addPullSecret adds the image pull secret to a pod spec, when the config file
+// has a pull secret file. It is applied with the pod spec mutators, see
+// MutatePodSpec, the pod must be in a namespace created by the framework.
+func addPullSecret(spec *v1.PodSpec) {
+	if pullSecret == nil {
+		return
+	}
+	for _, secret := range spec.ImagePullSecrets {
+		if secret.Name == PullSecretName {
+			return
+		}
+	}
+	spec.ImagePullSecrets = append(spec.ImagePullSecrets, v1.LocalObjectReference{Name: PullSecretName})
+}
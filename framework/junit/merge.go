@@ -0,0 +1,314 @@
+package junit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+)
+
+// NodeReportFile returns the path of the report written by a single ginkgo node.
+func NodeReportFile(dir, prefix string, node int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%02d.xml", prefix, node))
+}
+
+// MergedReportFile returns the path of the report merged from all nodes.
+func MergedReportFile(dir, prefix string) string {
+	return filepath.Join(dir, prefix+".xml")
+}
+
+// JSONFile returns the path of the JSON rendering of a JUnit report.
+func JSONFile(filename string) string {
+	return strings.TrimSuffix(filename, ".xml") + ".json"
+}
+
+// FindNodeReports lists the per-node reports with the given prefix in dir, ordered by node.
+func FindNodeReports(dir, prefix string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + `_(\d+)\.xml$`)
+	nodes := map[string]int{}
+	var files []string
+	for _, entry := range entries {
+		m := pattern.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		node, _ := strconv.Atoi(m[1])
+		path := filepath.Join(dir, entry.Name())
+		nodes[path] = node
+		files = append(files, path)
+	}
+	sort.Slice(files, func(i, j int) bool { return nodes[files[i]] < nodes[files[j]] })
+	return files, nil
+}
+
+// ReadFile parses a JUnit report.
+func ReadFile(filename string) (*TestSuite, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	suite := &TestSuite{}
+	if err := xml.Unmarshal(data, suite); err != nil {
+		return nil, fmt.Errorf("error parsing JUnit report %s: %v", filename, err)
+	}
+	return suite, nil
+}
+
+// ReadJSONFile parses the JSON rendering of a report.
+func ReadJSONFile(filename string) (*TestSuite, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	suite := &TestSuite{}
+	if err := json.Unmarshal(data, suite); err != nil {
+		return nil, fmt.Errorf("error parsing JSON report %s: %v", filename, err)
+	}
+	return suite, nil
+}
+
+// ReadRun reads the results of a run from dir. It prefers the merged report,
+// JSON then JUnit, and falls back to merging the per-node reports.
+func ReadRun(dir, prefix string) (*TestSuite, error) {
+	merged := MergedReportFile(dir, prefix)
+	if _, err := os.Stat(JSONFile(merged)); err == nil {
+		return ReadJSONFile(JSONFile(merged))
+	}
+	if _, err := os.Stat(merged); err == nil {
+		return ReadFile(merged)
+	}
+
+	files, err := FindNodeReports(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no reports with prefix %q found in %s", prefix, dir)
+	}
+	var suites []*TestSuite
+	for _, file := range files {
+		suite, err := ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, suite)
+	}
+	return Merge("", suites...), nil
+}
+
+// WriteFile writes a JUnit report. The file is renamed into place so readers
+// never observe a partially written report.
+func WriteFile(filename string, suite *TestSuite) error {
+	data, err := xml.MarshalIndent(suite, "  ", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append([]byte(xml.Header), data...))
+}
+
+// WriteJSONFile writes the JSON rendering of a report.
+func WriteJSONFile(filename string, suite *TestSuite) error {
+	data, err := json.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data)
+}
+
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// Merge combines the reports of several nodes into one suite named name.
+// Test cases and quarantined specs are concatenated, totals are recomputed, the suite time is the
+// longest node time and properties are de-duplicated.
+func Merge(name string, suites ...*TestSuite) *TestSuite {
+	merged := &TestSuite{
+		Name:      name,
+		TestCases: []TestCase{},
+	}
+	for _, suite := range suites {
+		if merged.Name == "" {
+			merged.Name = suite.Name
+		}
+		if merged.Timestamp == "" || (suite.Timestamp != "" && suite.Timestamp < merged.Timestamp) {
+			merged.Timestamp = suite.Timestamp
+		}
+		if suite.Time > merged.Time {
+			merged.Time = suite.Time
+		}
+		merged.Errors += suite.Errors
+		if suite.Properties != nil {
+			for _, p := range suite.Properties.Properties {
+				merged.AddProperty(p.Name, p.Value)
+			}
+		}
+		merged.TestCases = append(merged.TestCases, suite.TestCases...)
+		merged.Quarantined = append(merged.Quarantined, suite.Quarantined...)
+	}
+	merged.TestCases = dropSkippedDuplicates(merged.TestCases)
+	merged.Recount()
+	return merged
+}
+
+// dropSkippedDuplicates drops the skipped test cases of the specs reported more
+// than once, e.g. skipped by a run and run by another one. A spec run somewhere
+// is reported as run, and a spec skipped everywhere is reported once.
+func dropSkippedDuplicates(testCases []TestCase) []TestCase {
+	run := map[string]bool{}
+	for _, tc := range testCases {
+		if tc.Skipped == nil || tc.Status == StatusQuarantined {
+			run[tc.Name] = true
+		}
+	}
+	seen := map[string]bool{}
+	kept := []TestCase{}
+	for _, tc := range testCases {
+		if tc.Skipped != nil && tc.Status != StatusQuarantined {
+			if run[tc.Name] || seen[tc.Name] {
+				continue
+			}
+			seen[tc.Name] = true
+		}
+		kept = append(kept, tc)
+	}
+	return kept
+}
+
+// MergeFiles merges the given reports into output, adding properties to the result.
+// The JSON rendering of the merged report is written next to it.
+func MergeFiles(output, name string, files []string, properties []Property) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no JUnit reports to merge")
+	}
+
+	var suites []*TestSuite
+	for _, file := range files {
+		suite, err := ReadFile(file)
+		if err != nil {
+			return err
+		}
+		suites = append(suites, suite)
+	}
+
+	merged := Merge(name, suites...)
+	for _, p := range properties {
+		merged.AddProperty(p.Name, p.Value)
+	}
+	if err := WriteFile(output, merged); err != nil {
+		return err
+	}
+	return WriteJSONFile(JSONFile(output), merged)
+}
+
+// MergeReporter merges the per-node reports once the suite has ended. It only
+// acts on ginkgo node 1, which waits for the reports of all the other nodes.
+// It must be registered after the reporter writing the node report.
+type MergeReporter struct {
+	dir      string
+	prefix   string
+	timeout  time.Duration
+	started  time.Time
+	included []string
+}
+
+// NewMergeReporter creates a reporter merging the node reports found in dir.
+func NewMergeReporter(dir, prefix string, timeout time.Duration) *MergeReporter {
+	return &MergeReporter{
+		dir:     dir,
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
+
+// Include adds reports to the merge, e.g. written by another run of the suite.
+// They are merged if they were written during the run, and ignored otherwise.
+func (r *MergeReporter) Include(files ...string) {
+	r.included = append(r.included, files...)
+}
+
+func (r *MergeReporter) SpecSuiteWillBegin(config config.GinkgoConfigType, summary *types.SuiteSummary) {
+	// file modification times may be coarser than the wall clock
+	r.started = time.Now().Truncate(time.Second)
+}
+
+func (r *MergeReporter) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+func (r *MergeReporter) SpecWillRun(specSummary *types.SpecSummary) {}
+
+func (r *MergeReporter) SpecDidComplete(specSummary *types.SpecSummary) {}
+
+func (r *MergeReporter) AfterSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+func (r *MergeReporter) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	if config.GinkgoConfig.ParallelNode != 1 {
+		return
+	}
+
+	var files []string
+	for node := 1; node <= ParallelNodes(); node++ {
+		files = append(files, NodeReportFile(r.dir, r.prefix, node))
+	}
+	if err := WaitForFiles(files, r.started, r.timeout); err != nil {
+		fmt.Printf("Failed to merge JUnit reports: %v\n", err)
+		return
+	}
+	for _, file := range r.included {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Before(r.started) {
+			files = append(files, file)
+		}
+	}
+	output := MergedReportFile(r.dir, r.prefix)
+	if err := MergeFiles(output, summary.SuiteDescription, files, nil); err != nil {
+		fmt.Printf("Failed to merge JUnit reports into %s: %v\n", output, err)
+	}
+}
+
+// ParallelNodes returns the number of ginkgo nodes running the suite.
+func ParallelNodes() int {
+	if config.GinkgoConfig.ParallelTotal < 1 {
+		return 1
+	}
+	return config.GinkgoConfig.ParallelTotal
+}
+
+// WaitForFiles waits until every file has been written since the given time.
+// Nodes use it to wait for files written by the other nodes at the end of a run.
+func WaitForFiles(files []string, since time.Time, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var missing []string
+		for _, file := range files {
+			// files left over from a previous run do not count
+			if info, err := os.Stat(file); err != nil || info.ModTime().Before(since) {
+				missing = append(missing, file)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for %v", timeout, missing)
+		}
+		time.Sleep(time.Second)
+	}
+}
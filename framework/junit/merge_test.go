@@ -0,0 +1,194 @@
+package junit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func passed(name string) TestCase {
+	return TestCase{Name: name, ClassName: "e2e", Time: 1}
+}
+
+func failed(name string) TestCase {
+	return TestCase{Name: name, ClassName: "e2e", Time: 1, FailureMessage: &FailureMessage{Type: "Failure", Message: name + " failed"}}
+}
+
+func skipped(name string) TestCase {
+	return TestCase{Name: name, ClassName: "e2e", Skipped: &Skipped{}}
+}
+
+func flaky(name string) TestCase {
+	tc := passed(name)
+	tc.Status = StatusFlaky
+	tc.Attempts = 2
+	tc.FlakyFailures = []FailedAttempt{{Attempt: 1, Type: "Failure", Message: name + " failed", Time: 1}}
+	return tc
+}
+
+func rerunFailed(name string) TestCase {
+	tc := failed(name)
+	tc.Attempts = 2
+	tc.RerunFailures = []FailedAttempt{{Attempt: 1, Type: "Timeout", Message: name + " timed out", Time: 1}}
+	return tc
+}
+
+func quarantined(name string) TestCase {
+	tc := skipped(name)
+	tc.Status = StatusQuarantined
+	return tc
+}
+
+func names(testCases []TestCase) []string {
+	var names []string
+	for _, tc := range testCases {
+		names = append(names, tc.Name)
+	}
+	return names
+}
+
+func TestRecount(t *testing.T) {
+	suite := &TestSuite{
+		Tests:    100,
+		Failures: 100,
+		TestCases: []TestCase{
+			passed("a"), failed("b"), skipped("c"), flaky("d"), rerunFailed("e"), quarantined("f"),
+		},
+	}
+	suite.Recount()
+	if suite.Tests != 6 || suite.Failures != 2 || suite.Skipped != 2 || suite.Flaky != 1 {
+		t.Errorf("Recount() = %d tests, %d failures, %d skipped, %d flaky, want 6, 2, 2, 1", suite.Tests, suite.Failures, suite.Skipped, suite.Flaky)
+	}
+}
+
+func TestDropSkippedDuplicates(t *testing.T) {
+	tests := []struct {
+		name      string
+		testCases []TestCase
+		want      []string
+	}{
+		{
+			name:      "no duplicates",
+			testCases: []TestCase{passed("a"), skipped("b"), failed("c")},
+			want:      []string{"a", "b", "c"},
+		},
+		{
+			name:      "skipped by one run, run by another",
+			testCases: []TestCase{skipped("a"), passed("b"), passed("a")},
+			want:      []string{"b", "a"},
+		},
+		{
+			name:      "skipped everywhere",
+			testCases: []TestCase{skipped("a"), skipped("a"), skipped("a")},
+			want:      []string{"a"},
+		},
+		{
+			name:      "quarantined failure is run",
+			testCases: []TestCase{skipped("a"), quarantined("a")},
+			want:      []string{"a"},
+		},
+		{
+			name:      "run twice",
+			testCases: []TestCase{failed("a"), passed("a")},
+			want:      []string{"a", "a"},
+		},
+	}
+	for _, test := range tests {
+		got := dropSkippedDuplicates(test.testCases)
+		if !reflect.DeepEqual(names(got), test.want) {
+			t.Errorf("%s: dropSkippedDuplicates() = %v, want %v", test.name, names(got), test.want)
+		}
+	}
+
+	kept := dropSkippedDuplicates([]TestCase{skipped("a"), quarantined("a")})
+	if kept[0].Status != StatusQuarantined {
+		t.Errorf("dropSkippedDuplicates() kept the skipped test case instead of the quarantined one")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	node1 := &TestSuite{
+		Name:       "e2e",
+		Time:       10,
+		Timestamp:  "2019-08-01T10:00:05Z",
+		Errors:     1,
+		Properties: &Properties{Properties: []Property{{Name: "RunId", Value: "1234"}}},
+		TestCases:  []TestCase{passed("a"), skipped("serial"), flaky("b")},
+	}
+	node2 := &TestSuite{
+		Name:        "e2e",
+		Time:        12,
+		Timestamp:   "2019-08-01T10:00:00Z",
+		Properties:  &Properties{Properties: []Property{{Name: "RunId", Value: "1234"}, {Name: "Node", Value: "2"}}},
+		TestCases:   []TestCase{rerunFailed("c"), skipped("serial"), quarantined("d")},
+		Quarantined: []QuarantinedSpec{{Name: "d", Failed: true}},
+	}
+	serial := &TestSuite{
+		Name:      "e2e",
+		Time:      5,
+		Timestamp: "2019-08-01T10:01:00Z",
+		TestCases: []TestCase{passed("serial")},
+	}
+
+	merged := Merge("", node1, node2, serial)
+	if merged.Name != "e2e" || merged.Time != 12 || merged.Timestamp != "2019-08-01T10:00:00Z" || merged.Errors != 1 {
+		t.Errorf("Merge() = %q, time %v, timestamp %q, %d errors, want \"e2e\", 12, \"2019-08-01T10:00:00Z\", 1", merged.Name, merged.Time, merged.Timestamp, merged.Errors)
+	}
+	if want := []string{"a", "b", "c", "d", "serial"}; !reflect.DeepEqual(names(merged.TestCases), want) {
+		t.Errorf("Merge() test cases = %v, want %v", names(merged.TestCases), want)
+	}
+	if merged.Tests != 5 || merged.Failures != 1 || merged.Skipped != 1 || merged.Flaky != 1 {
+		t.Errorf("Merge() = %d tests, %d failures, %d skipped, %d flaky, want 5, 1, 1, 1", merged.Tests, merged.Failures, merged.Skipped, merged.Flaky)
+	}
+	if want := []Property{{Name: "RunId", Value: "1234"}, {Name: "Node", Value: "2"}}; !reflect.DeepEqual(merged.Properties.Properties, want) {
+		t.Errorf("Merge() properties = %v, want %v", merged.Properties.Properties, want)
+	}
+	if merged.QuarantinedFailures() != 1 {
+		t.Errorf("Merge() has %d quarantined failures, want 1", merged.QuarantinedFailures())
+	}
+	if named := Merge("renamed", node1); named.Name != "renamed" {
+		t.Errorf("Merge(\"renamed\") = %q, want \"renamed\"", named.Name)
+	}
+}
+
+// TestWriteRead checks the failed attempts of retried specs survive the XML
+// and JSON renderings.
+func TestWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "junit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	suite := &TestSuite{Name: "e2e", TestCases: []TestCase{flaky("a"), rerunFailed("b"), passed("c")}}
+	suite.Recount()
+	filename := filepath.Join(dir, "junit.xml")
+	if err := WriteFile(filename, suite); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteJSONFile(JSONFile(filename), suite); err != nil {
+		t.Fatal(err)
+	}
+
+	fromXML, err := ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ReadJSONFile(JSONFile(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for format, read := range map[string]*TestSuite{"XML": fromXML, "JSON": fromJSON} {
+		if !reflect.DeepEqual(read.TestCases, suite.TestCases) {
+			t.Errorf("%s test cases = %+v, want %+v", format, read.TestCases, suite.TestCases)
+		}
+		if read.Flaky != 1 || read.Failures != 1 {
+			t.Errorf("%s report has %d flaky and %d failures, want 1 and 1", format, read.Flaky, read.Failures)
+		}
+		if !read.TestCases[0].IsFlaky() || read.TestCases[0].Status != StatusFlaky {
+			t.Errorf("%s test case %q isn't flaky", format, read.TestCases[0].Name)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package junit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+	"github.com/zryfish/framework/framework/redact"
+)
+
+// PropertiesFunc returns the metadata attached to a report. It is evaluated
+// when the suite ends, so values settled during BeforeSuite are picked up.
+type PropertiesFunc func() []Property
+
+// QuarantineFunc tells whether the spec with the given name is quarantined.
+// The returned entry carries the reason, issue and expiry of the quarantine.
+type QuarantineFunc func(name string) (QuarantinedSpec, bool)
+
+// Reporter is a ginkgo reporter writing a JUnit report with suite properties,
+// along with its JSON rendering. Attempts of a spec retried by ginkgo's flake
+// attempts are folded into a single test case.
+type Reporter struct {
+	suite      TestSuite
+	filename   string
+	properties PropertiesFunc
+	quarantine QuarantineFunc
+
+	// lastSpec identifies the spec of the last test case, retries run right after the failed attempt
+	lastSpec string
+}
+
+// NewReporter creates a reporter writing to filename. properties may be nil.
+func NewReporter(filename string, properties PropertiesFunc) *Reporter {
+	return &Reporter{
+		filename:   filename,
+		properties: properties,
+	}
+}
+
+// SetQuarantine sets the function used to find quarantined specs. Failures of
+// quarantined specs are reported in a separate section and don't fail the suite.
+func (r *Reporter) SetQuarantine(quarantine QuarantineFunc) {
+	r.quarantine = quarantine
+}
+
+// OnlyQuarantinedFailures returns true once the suite has ended if the only
+// failed specs were quarantined ones.
+func (r *Reporter) OnlyQuarantinedFailures() bool {
+	return r.suite.Failures == 0 && r.suite.QuarantinedFailures() > 0
+}
+
+func (r *Reporter) SpecSuiteWillBegin(config config.GinkgoConfigType, summary *types.SuiteSummary) {
+	r.suite = TestSuite{
+		Name:      summary.SuiteDescription,
+		Timestamp: time.Now().Format(time.RFC3339),
+		TestCases: []TestCase{},
+	}
+}
+
+func (r *Reporter) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {
+	r.handleSetupSummary("BeforeSuite", setupSummary)
+}
+
+func (r *Reporter) SpecWillRun(specSummary *types.SpecSummary) {
+}
+
+func (r *Reporter) SpecDidComplete(specSummary *types.SpecSummary) {
+	testCase := TestCase{
+		Name:      strings.Join(specSummary.ComponentTexts[1:], " "),
+		ClassName: r.suite.Name,
+		Time:      specSummary.RunTime.Seconds(),
+	}
+	if specSummary.HasFailureState() {
+		testCase.FailureMessage = &FailureMessage{
+			Type:    failureTypeForState(specSummary.State),
+			Message: failureMessage(specSummary.Failure),
+		}
+		testCase.SystemOut = redact.String(specSummary.CapturedOutput)
+	}
+	if specSummary.State == types.SpecStateSkipped || specSummary.State == types.SpecStatePending {
+		testCase.Skipped = &Skipped{Message: specSummary.Failure.Message}
+	}
+
+	key := specKey(specSummary)
+	if last := len(r.suite.TestCases) - 1; key == r.lastSpec && last >= 0 && r.suite.TestCases[last].Failed() {
+		r.suite.TestCases[last] = retriedTestCase(r.suite.TestCases[last], testCase)
+		return
+	}
+	r.lastSpec = key
+	r.suite.TestCases = append(r.suite.TestCases, testCase)
+}
+
+// retriedTestCase folds the failed previous attempt of a spec into its latest attempt.
+func retriedTestCase(previous, latest TestCase) TestCase {
+	attempts := previous.Attempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	failures := append(previous.RerunFailures, FailedAttempt{
+		Attempt:   attempts,
+		Type:      previous.FailureMessage.Type,
+		Message:   previous.FailureMessage.Message,
+		Time:      previous.Time,
+		SystemOut: previous.SystemOut,
+	})
+
+	// the test case keeps the time of the latest attempt, the failed attempts keep theirs
+	latest.Attempts = attempts + 1
+	if latest.Failed() {
+		latest.RerunFailures = failures
+	} else {
+		latest.FlakyFailures = failures
+		latest.Status = StatusFlaky
+	}
+	return latest
+}
+
+func specKey(specSummary *types.SpecSummary) string {
+	location := specSummary.ComponentCodeLocations[len(specSummary.ComponentCodeLocations)-1]
+	return strings.Join(specSummary.ComponentTexts, " ") + "@" + location.String()
+}
+
+func (r *Reporter) AfterSuiteDidRun(setupSummary *types.SetupSummary) {
+	r.handleSetupSummary("AfterSuite", setupSummary)
+}
+
+func (r *Reporter) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	r.suite.Time = math.Trunc(summary.RunTime.Seconds()*1000) / 1000
+	if r.properties != nil {
+		for _, p := range r.properties() {
+			r.suite.AddProperty(p.Name, p.Value)
+		}
+	}
+	r.applyQuarantine()
+	r.suite.Recount()
+	if err := WriteFile(r.filename, &r.suite); err != nil {
+		fmt.Printf("Failed to generate JUnit report %s\n\t%s\n", r.filename, err.Error())
+	}
+	if err := WriteJSONFile(JSONFile(r.filename), &r.suite); err != nil {
+		fmt.Printf("Failed to generate JSON report %s\n\t%s\n", JSONFile(r.filename), err.Error())
+	}
+}
+
+// applyQuarantine moves the failures of quarantined specs into the quarantined section.
+func (r *Reporter) applyQuarantine() {
+	if r.quarantine == nil {
+		return
+	}
+	for i := range r.suite.TestCases {
+		tc := &r.suite.TestCases[i]
+		if tc.Skipped != nil && !tc.Failed() {
+			continue
+		}
+		q, ok := r.quarantine(tc.Name)
+		if !ok {
+			continue
+		}
+		q.Name = tc.Name
+		if tc.Failed() {
+			q.Failed = true
+			q.FailureMessage = tc.FailureMessage
+			q.SystemOut = tc.SystemOut
+			tc.FailureMessage = nil
+			tc.SystemOut = ""
+			tc.Status = StatusQuarantined
+			tc.Skipped = &Skipped{Message: fmt.Sprintf("quarantined failure: %s", q.Reason)}
+		}
+		r.suite.Quarantined = append(r.suite.Quarantined, q)
+	}
+}
+
+func (r *Reporter) handleSetupSummary(name string, setupSummary *types.SetupSummary) {
+	if setupSummary.State == types.SpecStatePassed {
+		return
+	}
+	r.suite.TestCases = append(r.suite.TestCases, TestCase{
+		Name:      name,
+		ClassName: r.suite.Name,
+		FailureMessage: &FailureMessage{
+			Type:    failureTypeForState(setupSummary.State),
+			Message: failureMessage(setupSummary.Failure),
+		},
+		SystemOut: redact.String(setupSummary.CapturedOutput),
+		Time:      setupSummary.RunTime.Seconds(),
+	})
+}
+
+func failureMessage(failure types.SpecFailure) string {
+	return redact.String(fmt.Sprintf("%s\n%s\n%s", failure.ComponentCodeLocation.String(), failure.Message, failure.Location.String()))
+}
+
+func failureTypeForState(state types.SpecState) string {
+	switch state {
+	case types.SpecStateFailed:
+		return "Failure"
+	case types.SpecStateTimedOut:
+		return "Timeout"
+	case types.SpecStatePanicked:
+		return "Panic"
+	default:
+		return ""
+	}
+}
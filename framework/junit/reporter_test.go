@@ -0,0 +1,97 @@
+package junit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+)
+
+// attempt returns the summary of an attempt of the spec "volumes mounts a volume".
+func attempt(state types.SpecState, line int) *types.SpecSummary {
+	summary := &types.SpecSummary{
+		ComponentTexts:         []string{"[Top Level]", "volumes", "mounts a volume"},
+		ComponentCodeLocations: []types.CodeLocation{{}, {FileName: "volumes.go", LineNumber: 10}, {FileName: "volumes.go", LineNumber: line}},
+		State:                  state,
+		RunTime:                time.Second,
+	}
+	if state.IsFailure() {
+		summary.Failure = types.SpecFailure{Message: "timed out waiting for the pod"}
+		summary.CapturedOutput = "output"
+	}
+	return summary
+}
+
+func TestReporterAttempts(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []*types.SpecSummary
+		want     []TestCase
+	}{
+		{
+			name:     "passed",
+			attempts: []*types.SpecSummary{attempt(types.SpecStatePassed, 20)},
+			want:     []TestCase{{Name: "volumes mounts a volume", ClassName: "e2e", Time: 1}},
+		},
+		{
+			name:     "flaky",
+			attempts: []*types.SpecSummary{attempt(types.SpecStateFailed, 20), attempt(types.SpecStateTimedOut, 20), attempt(types.SpecStatePassed, 20)},
+			want: []TestCase{{
+				Name:      "volumes mounts a volume",
+				ClassName: "e2e",
+				Status:    StatusFlaky,
+				Attempts:  3,
+				Time:      1,
+				FlakyFailures: []FailedAttempt{
+					{Attempt: 1, Type: "Failure", Message: failureMessage(types.SpecFailure{Message: "timed out waiting for the pod"}), Time: 1, SystemOut: "output"},
+					{Attempt: 2, Type: "Timeout", Message: failureMessage(types.SpecFailure{Message: "timed out waiting for the pod"}), Time: 1, SystemOut: "output"},
+				},
+			}},
+		},
+		{
+			name:     "failed every attempt",
+			attempts: []*types.SpecSummary{attempt(types.SpecStateFailed, 20), attempt(types.SpecStatePanicked, 20)},
+			want: []TestCase{{
+				Name:           "volumes mounts a volume",
+				ClassName:      "e2e",
+				Attempts:       2,
+				Time:           1,
+				FailureMessage: &FailureMessage{Type: "Panic", Message: failureMessage(types.SpecFailure{Message: "timed out waiting for the pod"})},
+				SystemOut:      "output",
+				RerunFailures: []FailedAttempt{
+					{Attempt: 1, Type: "Failure", Message: failureMessage(types.SpecFailure{Message: "timed out waiting for the pod"}), Time: 1, SystemOut: "output"},
+				},
+			}},
+		},
+		{
+			// specs with the same text at other locations are other specs
+			name:     "same text, other spec",
+			attempts: []*types.SpecSummary{attempt(types.SpecStateFailed, 20), attempt(types.SpecStatePassed, 30)},
+			want: []TestCase{
+				{Name: "volumes mounts a volume", ClassName: "e2e", Time: 1, FailureMessage: &FailureMessage{Type: "Failure", Message: failureMessage(types.SpecFailure{Message: "timed out waiting for the pod"})}, SystemOut: "output"},
+				{Name: "volumes mounts a volume", ClassName: "e2e", Time: 1},
+			},
+		},
+		{
+			// a passed spec run again isn't retried
+			name:     "passed, then run again",
+			attempts: []*types.SpecSummary{attempt(types.SpecStatePassed, 20), attempt(types.SpecStatePassed, 20)},
+			want: []TestCase{
+				{Name: "volumes mounts a volume", ClassName: "e2e", Time: 1},
+				{Name: "volumes mounts a volume", ClassName: "e2e", Time: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		r := NewReporter("", nil)
+		r.SpecSuiteWillBegin(config.GinkgoConfigType{}, &types.SuiteSummary{SuiteDescription: "e2e"})
+		for _, summary := range test.attempts {
+			r.SpecDidComplete(summary)
+		}
+		if !reflect.DeepEqual(r.suite.TestCases, test.want) {
+			t.Errorf("%s: test cases = %+v, want %+v", test.name, r.suite.TestCases, test.want)
+		}
+	}
+}
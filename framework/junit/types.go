@@ -0,0 +1,157 @@
+package junit
+
+import (
+	"encoding/xml"
+)
+
+// TestSuite is a JUnit test suite. It is a superset of the document written by
+// ginkgo's JUnit reporter, so reports from either can be read back.
+// The same structure is used for the JSON rendering of a report.
+type TestSuite struct {
+	XMLName    xml.Name    `xml:"testsuite" json:"-"`
+	Name       string      `xml:"name,attr" json:"name"`
+	Tests      int         `xml:"tests,attr" json:"tests"`
+	Failures   int         `xml:"failures,attr" json:"failures"`
+	Errors     int         `xml:"errors,attr" json:"errors"`
+	Skipped    int         `xml:"skipped,attr" json:"skipped"`
+	Flaky      int         `xml:"flaky,attr" json:"flaky"`
+	Time       float64     `xml:"time,attr" json:"time"`
+	Timestamp  string      `xml:"timestamp,attr,omitempty" json:"timestamp,omitempty"`
+	Properties *Properties `xml:"properties,omitempty" json:"properties,omitempty"`
+	TestCases  []TestCase  `xml:"testcase" json:"testcases"`
+
+	// Quarantined lists the quarantined specs that ran, their failures do not count as suite failures.
+	Quarantined []QuarantinedSpec `xml:"quarantined>spec,omitempty" json:"quarantined,omitempty"`
+}
+
+// Properties holds the suite metadata.
+type Properties struct {
+	Properties []Property `xml:"property" json:"property"`
+}
+
+// Property is a single name/value pair of suite metadata.
+type Property struct {
+	Name  string `xml:"name,attr" json:"name"`
+	Value string `xml:"value,attr" json:"value"`
+}
+
+const (
+	// StatusFlaky is the status of a test case that failed and then passed on retry.
+	StatusFlaky = "flaky"
+	// StatusQuarantined is the status of a quarantined test case that failed.
+	StatusQuarantined = "quarantined"
+)
+
+// TestCase is a single spec, or a failed BeforeSuite/AfterSuite node.
+// When a spec is retried, the failures of the earlier attempts are kept in
+// FlakyFailures if it eventually passed, or in RerunFailures if it did not,
+// each with its own time, Time is the time of the latest attempt.
+type TestCase struct {
+	Name           string          `xml:"name,attr" json:"name"`
+	ClassName      string          `xml:"classname,attr" json:"classname"`
+	Status         string          `xml:"status,attr,omitempty" json:"status,omitempty"`
+	Attempts       int             `xml:"attempts,attr,omitempty" json:"attempts,omitempty"`
+	FailureMessage *FailureMessage `xml:"failure,omitempty" json:"failure,omitempty"`
+	Skipped        *Skipped        `xml:"skipped,omitempty" json:"skipped,omitempty"`
+	FlakyFailures  []FailedAttempt `xml:"flakyFailure,omitempty" json:"flakyFailures,omitempty"`
+	RerunFailures  []FailedAttempt `xml:"rerunFailure,omitempty" json:"rerunFailures,omitempty"`
+	Time           float64         `xml:"time,attr" json:"time"`
+	SystemOut      string          `xml:"system-out,omitempty" json:"systemOut,omitempty"`
+}
+
+// FailureMessage describes why a test case failed.
+type FailureMessage struct {
+	Type    string `xml:"type,attr" json:"type"`
+	Message string `xml:",chardata" json:"message"`
+}
+
+// FailedAttempt is a failed attempt of a spec that was retried.
+type FailedAttempt struct {
+	Attempt   int     `xml:"attempt,attr" json:"attempt"`
+	Type      string  `xml:"type,attr" json:"type"`
+	Message   string  `xml:"message,attr" json:"message"`
+	Time      float64 `xml:"time,attr" json:"time"`
+	SystemOut string  `xml:"system-out,omitempty" json:"systemOut,omitempty"`
+}
+
+// QuarantinedSpec records the outcome of a quarantined spec. The test case of a
+// failed quarantined spec is reported as skipped and its failure is kept here.
+type QuarantinedSpec struct {
+	Name           string          `xml:"name,attr" json:"name"`
+	Reason         string          `xml:"reason,attr,omitempty" json:"reason,omitempty"`
+	Issue          string          `xml:"issue,attr,omitempty" json:"issue,omitempty"`
+	Expires        string          `xml:"expires,attr,omitempty" json:"expires,omitempty"`
+	Expired        bool            `xml:"expired,attr,omitempty" json:"expired,omitempty"`
+	Failed         bool            `xml:"failed,attr" json:"failed"`
+	FailureMessage *FailureMessage `xml:"failure,omitempty" json:"failure,omitempty"`
+	SystemOut      string          `xml:"system-out,omitempty" json:"systemOut,omitempty"`
+}
+
+// Skipped marks a skipped or pending test case.
+type Skipped struct {
+	XMLName xml.Name `xml:"skipped" json:"-"`
+	Message string   `xml:"message,attr,omitempty" json:"message,omitempty"`
+}
+
+// Failed returns true if the test case has a failure.
+func (t *TestCase) Failed() bool {
+	return t.FailureMessage != nil
+}
+
+// IsFlaky returns true if the test case passed after failed attempts.
+func (t *TestCase) IsFlaky() bool {
+	return !t.Failed() && len(t.FlakyFailures) > 0
+}
+
+// AddProperty appends a property to the suite unless an identical one exists.
+func (s *TestSuite) AddProperty(name, value string) {
+	if s.Properties == nil {
+		s.Properties = &Properties{}
+	}
+	for _, p := range s.Properties.Properties {
+		if p.Name == name && p.Value == value {
+			return
+		}
+	}
+	s.Properties.Properties = append(s.Properties.Properties, Property{Name: name, Value: value})
+}
+
+// Property returns the value of the first property with the given name.
+func (s *TestSuite) Property(name string) (string, bool) {
+	if s.Properties == nil {
+		return "", false
+	}
+	for _, p := range s.Properties.Properties {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// QuarantinedFailures returns the number of quarantined specs that failed.
+func (s *TestSuite) QuarantinedFailures() int {
+	failed := 0
+	for _, q := range s.Quarantined {
+		if q.Failed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Recount recomputes the suite totals from its test cases.
+func (s *TestSuite) Recount() {
+	s.Tests, s.Failures, s.Skipped, s.Flaky = 0, 0, 0, 0
+	for i := range s.TestCases {
+		tc := &s.TestCases[i]
+		s.Tests++
+		if tc.Failed() {
+			s.Failures++
+		} else if tc.Skipped != nil {
+			s.Skipped++
+		} else if tc.IsFlaky() {
+			s.Flaky++
+		}
+	}
+}
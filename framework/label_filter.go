@@ -0,0 +1,346 @@
+package framework
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/onsi/ginkgo/config"
+)
+
+// Limits of the translation of label expressions into ginkgo regexes, the size
+// of the focus regex grows with the factorial of the labels of a conjunction.
+const (
+	maxLabelConjunction = 4
+	maxLabelTerms       = 32
+)
+
+// labelExpr is a node of a parsed label expression.
+type labelExpr interface{}
+
+type labelAtom struct {
+	label   Label
+	negated bool
+}
+
+type labelNot struct {
+	expr labelExpr
+}
+
+type labelAnd []labelExpr
+
+type labelOr []labelExpr
+
+// parseLabelExpr parses a boolean label expression, labels combined with
+// "&&", "||", "!" and parentheses, e.g. "Feature:CSI && !(Slow || Serial)".
+func parseLabelExpr(s string) (labelExpr, error) {
+	p := &labelParser{input: s}
+	p.tokenize()
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in label expression %q", p.tokens[p.pos], s)
+	}
+	return expr, nil
+}
+
+type labelParser struct {
+	input  string
+	tokens []string
+	pos    int
+}
+
+func (p *labelParser) tokenize() {
+	s := p.input
+	for len(s) > 0 {
+		switch {
+		case unicode.IsSpace(rune(s[0])):
+			s = s[1:]
+		case strings.HasPrefix(s, "&&"), strings.HasPrefix(s, "||"):
+			p.tokens = append(p.tokens, s[:2])
+			s = s[2:]
+		case strings.ContainsRune("()!", rune(s[0])):
+			p.tokens = append(p.tokens, s[:1])
+			s = s[1:]
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return unicode.IsSpace(r) || strings.ContainsRune("()!&|", r)
+			})
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				// a lone & or |
+				end = 1
+			}
+			p.tokens = append(p.tokens, s[:end])
+			s = s[end:]
+		}
+	}
+}
+
+func (p *labelParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *labelParser) parseOr() (labelExpr, error) {
+	terms := labelOr{}
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.next() != "||" {
+			break
+		}
+		p.pos++
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *labelParser) parseAnd() (labelExpr, error) {
+	terms := labelAnd{}
+	for {
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.next() != "&&" {
+			break
+		}
+		p.pos++
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *labelParser) parseUnary() (labelExpr, error) {
+	token := p.next()
+	p.pos++
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of label expression %q", p.input)
+	case "!":
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return labelNot{expr: expr}, nil
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ) in label expression %q", p.input)
+		}
+		p.pos++
+		return expr, nil
+	case ")", "&&", "||", "&", "|":
+		return nil, fmt.Errorf("unexpected %q in label expression %q", token, p.input)
+	default:
+		return labelAtom{label: Label(strings.TrimSuffix(strings.TrimPrefix(token, "["), "]"))}, nil
+	}
+}
+
+// pushNegations moves the negations of expr down to the labels.
+func pushNegations(expr labelExpr, negate bool) labelExpr {
+	switch e := expr.(type) {
+	case labelAtom:
+		return labelAtom{label: e.label, negated: e.negated != negate}
+	case labelNot:
+		return pushNegations(e.expr, !negate)
+	case labelAnd:
+		terms := make([]labelExpr, len(e))
+		for i, term := range e {
+			terms[i] = pushNegations(term, negate)
+		}
+		if negate {
+			return labelOr(terms)
+		}
+		return labelAnd(terms)
+	case labelOr:
+		terms := make([]labelExpr, len(e))
+		for i, term := range e {
+			terms[i] = pushNegations(term, negate)
+		}
+		if negate {
+			return labelAnd(terms)
+		}
+		return labelOr(terms)
+	}
+	panic(fmt.Sprintf("unknown label expression %T", expr))
+}
+
+// flattenAnd returns the terms of nested conjunctions.
+func flattenAnd(expr labelExpr) []labelExpr {
+	and, ok := expr.(labelAnd)
+	if !ok {
+		return []labelExpr{expr}
+	}
+	var terms []labelExpr
+	for _, term := range and {
+		terms = append(terms, flattenAnd(term)...)
+	}
+	return terms
+}
+
+// positive returns true if expr has no negated label.
+func positive(expr labelExpr) bool {
+	switch e := expr.(type) {
+	case labelAtom:
+		return !e.negated
+	case labelAnd:
+		for _, term := range e {
+			if !positive(term) {
+				return false
+			}
+		}
+	case labelOr:
+		for _, term := range e {
+			if !positive(term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// disjunctiveTerms returns the sets of labels of a positive expression, a spec
+// matches the expression if it has all the labels of one of the sets.
+func disjunctiveTerms(expr labelExpr) [][]Label {
+	switch e := expr.(type) {
+	case labelAtom:
+		return [][]Label{{e.label}}
+	case labelOr:
+		var terms [][]Label
+		for _, term := range e {
+			terms = append(terms, disjunctiveTerms(term)...)
+		}
+		return terms
+	case labelAnd:
+		terms := [][]Label{{}}
+		for _, term := range e {
+			var product [][]Label
+			for _, left := range terms {
+				for _, right := range disjunctiveTerms(term) {
+					product = append(product, appendLabels(left, right))
+				}
+			}
+			terms = product
+		}
+		return terms
+	}
+	panic(fmt.Sprintf("unexpected label expression %T", expr))
+}
+
+// appendLabels returns the union of two sets of labels.
+func appendLabels(left, right []Label) []Label {
+	labels := append([]Label{}, left...)
+	for _, label := range right {
+		found := false
+		for _, l := range labels {
+			found = found || l == label
+		}
+		if !found {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// LabelFocusSkip translates a label expression into ginkgo focus and skip
+// regexes. Negations must apply to the whole selection, e.g. "A && !B" or
+// "(A || B) && !(C || D)", as ginkgo runs the specs matching the focus and
+// not matching the skip.
+func LabelFocusSkip(s string) (string, string, error) {
+	expr, err := parseLabelExpr(s)
+	if err != nil {
+		return "", "", err
+	}
+	conjuncts := flattenAnd(pushNegations(expr, false))
+
+	var skips []string
+	positives := labelAnd{}
+	for _, c := range conjuncts {
+		if atom, ok := c.(labelAtom); ok && atom.negated {
+			skips = append(skips, labelRegexp(atom.label))
+			continue
+		}
+		if !positive(c) {
+			return "", "", fmt.Errorf("label expression %q can't be translated to ginkgo focus and skip, negations must apply to the whole selection, e.g. \"A && !(B || C)\"", s)
+		}
+		positives = append(positives, c)
+	}
+	if len(positives) == 0 {
+		return "", strings.Join(skips, "|"), nil
+	}
+
+	terms := disjunctiveTerms(positives)
+	if len(terms) > maxLabelTerms {
+		return "", "", fmt.Errorf("label expression %q is too complex, it expands to more than %d alternatives", s, maxLabelTerms)
+	}
+	var focus []string
+	for _, term := range terms {
+		if len(term) > maxLabelConjunction {
+			return "", "", fmt.Errorf("label expression %q is too complex, it requires more than %d labels at once", s, maxLabelConjunction)
+		}
+		var regexes []string
+		for _, label := range term {
+			regexes = append(regexes, labelRegexp(label))
+		}
+		focus = append(focus, conjunctionRegexp(regexes))
+	}
+	return strings.Join(focus, "|"), strings.Join(skips, "|"), nil
+}
+
+// applyLabelFilter sets the ginkgo focus and skip from a label expression. In
+// parallel runs Serial specs are skipped, RunSerialSpecs runs them afterwards.
+func applyLabelFilter(s string) error {
+	if strings.TrimSpace(s) != "" {
+		focus, skip, err := LabelFocusSkip(s)
+		if err != nil {
+			return err
+		}
+		if focus != "" {
+			if config.GinkgoConfig.FocusString != "" {
+				return fmt.Errorf("--labels and --ginkgo.focus can't be combined, add the focused labels to --labels")
+			}
+			config.GinkgoConfig.FocusString = focus
+		}
+		config.GinkgoConfig.SkipString = alternatives(config.GinkgoConfig.SkipString, skip)
+	}
+
+	if config.GinkgoConfig.ParallelTotal > 1 {
+		serialFocus = labelRegexp(Serial)
+		if config.GinkgoConfig.FocusString != "" {
+			serialFocus = conjunctionRegexp([]string{config.GinkgoConfig.FocusString, serialFocus})
+		}
+		serialSkip = config.GinkgoConfig.SkipString
+		config.GinkgoConfig.SkipString = alternatives(config.GinkgoConfig.SkipString, labelRegexp(Serial))
+	}
+	return nil
+}
+
+// alternatives joins the non empty regexes into a regex matching any of them.
+func alternatives(regexes ...string) string {
+	var nonEmpty []string
+	for _, r := range regexes {
+		if r != "" {
+			nonEmpty = append(nonEmpty, r)
+		}
+	}
+	return strings.Join(nonEmpty, "|")
+}
@@ -0,0 +1,232 @@
+package framework
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func atom(label string) labelAtom {
+	return labelAtom{label: Label(label)}
+}
+
+func notAtom(label string) labelAtom {
+	return labelAtom{label: Label(label), negated: true}
+}
+
+func TestParseLabelExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want labelExpr
+		err  string
+	}{
+		{expr: "Slow", want: atom("Slow")},
+		{expr: "[Feature:CSI]", want: atom("Feature:CSI")},
+		{expr: "A && B || C", want: labelOr{labelAnd{atom("A"), atom("B")}, atom("C")}},
+		{expr: "A || B && C", want: labelOr{atom("A"), labelAnd{atom("B"), atom("C")}}},
+		{expr: "A && (B || C)", want: labelAnd{atom("A"), labelOr{atom("B"), atom("C")}}},
+		{expr: "!A && B", want: labelAnd{labelNot{expr: atom("A")}, atom("B")}},
+		{expr: "!(A || B)", want: labelNot{expr: labelOr{atom("A"), atom("B")}}},
+		{expr: "!!A", want: labelNot{expr: labelNot{expr: atom("A")}}},
+		{expr: "A&&!B", want: labelAnd{atom("A"), labelNot{expr: atom("B")}}},
+		{expr: "", err: "unexpected end"},
+		{expr: "A &&", err: "unexpected end"},
+		{expr: "(A || B", err: "missing )"},
+		{expr: "A)", err: `unexpected ")"`},
+		{expr: "A & B", err: `unexpected "&"`},
+		{expr: "A | B", err: `unexpected "|"`},
+		{expr: "A B", err: `unexpected "B"`},
+		{expr: "|| A", err: `unexpected "||"`},
+	}
+	for _, test := range tests {
+		got, err := parseLabelExpr(test.expr)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseLabelExpr(%q) error = %v, want an error containing %q", test.expr, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseLabelExpr(%q) failed: %v", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseLabelExpr(%q) = %#v, want %#v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestPushNegations(t *testing.T) {
+	tests := []struct {
+		expr string
+		want labelExpr
+	}{
+		{expr: "A", want: atom("A")},
+		{expr: "!A", want: notAtom("A")},
+		{expr: "!!A", want: atom("A")},
+		{expr: "!(A || B)", want: labelAnd{notAtom("A"), notAtom("B")}},
+		{expr: "!(A && B)", want: labelOr{notAtom("A"), notAtom("B")}},
+		{expr: "!(A && !B)", want: labelOr{notAtom("A"), atom("B")}},
+		{expr: "A && !(B || !(C && D))", want: labelAnd{atom("A"), labelAnd{notAtom("B"), labelAnd{atom("C"), atom("D")}}}},
+	}
+	for _, test := range tests {
+		expr, err := parseLabelExpr(test.expr)
+		if err != nil {
+			t.Fatalf("parseLabelExpr(%q) failed: %v", test.expr, err)
+		}
+		if got := pushNegations(expr, false); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pushNegations(%q) = %#v, want %#v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestDisjunctiveTerms(t *testing.T) {
+	tests := []struct {
+		expr string
+		want [][]Label
+	}{
+		{expr: "A", want: [][]Label{{"A"}}},
+		{expr: "A || B", want: [][]Label{{"A"}, {"B"}}},
+		{expr: "A && B", want: [][]Label{{"A", "B"}}},
+		{expr: "A && (B || C)", want: [][]Label{{"A", "B"}, {"A", "C"}}},
+		{expr: "(A || B) && (C || D)", want: [][]Label{{"A", "C"}, {"A", "D"}, {"B", "C"}, {"B", "D"}}},
+		{expr: "A && (A || B)", want: [][]Label{{"A"}, {"A", "B"}}},
+		{expr: "A && B || C", want: [][]Label{{"A", "B"}, {"C"}}},
+	}
+	for _, test := range tests {
+		expr, err := parseLabelExpr(test.expr)
+		if err != nil {
+			t.Fatalf("parseLabelExpr(%q) failed: %v", test.expr, err)
+		}
+		if got := disjunctiveTerms(expr); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("disjunctiveTerms(%q) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+// selected returns true if ginkgo runs the spec with the text for the focus
+// and skip regexes.
+func selected(focus, skip, text string) bool {
+	if focus != "" && !regexp.MustCompile(focus).MatchString(text) {
+		return false
+	}
+	return skip == "" || !regexp.MustCompile(skip).MatchString(text)
+}
+
+func TestLabelFocusSkip(t *testing.T) {
+	tests := []struct {
+		expr     string
+		selected []string
+		skipped  []string
+		err      string
+	}{
+		{
+			expr:     "Slow",
+			selected: []string{"mounts a volume [Slow]", "[Slow] [Serial] restarts a node"},
+			skipped:  []string{"mounts a volume", "mounts a volume [Slowly]", "mounts a Slow volume"},
+		},
+		{
+			expr:     "[Feature:CSI]",
+			selected: []string{"CSI mock [Feature:CSI] attaches a volume"},
+			skipped:  []string{"CSI mock [Feature:CSIInline]", "[Feature:CS.]"},
+		},
+		{
+			// && binds tighter than ||
+			expr:     "A && B || C",
+			selected: []string{"x [A] [B]", "x [B] y [A]", "x [C]", "[A] [C]"},
+			skipped:  []string{"x [A]", "x [B]", "x"},
+		},
+		{
+			expr:     "A && (B || C)",
+			selected: []string{"x [A] [B]", "x [C] [A]"},
+			skipped:  []string{"x [A]", "x [B] [C]"},
+		},
+		{
+			expr:     "A && !B",
+			selected: []string{"x [A]", "x [A] [C]"},
+			skipped:  []string{"x [A] [B]", "x [B]", "x"},
+		},
+		{
+			expr:     "!(Slow || Serial)",
+			selected: []string{"x", "x [Conformance]"},
+			skipped:  []string{"x [Slow]", "x [Serial]"},
+		},
+		{
+			expr:     "(A || B) && !(C || D)",
+			selected: []string{"x [A]", "x [B] [E]"},
+			skipped:  []string{"x [A] [C]", "x [B] [D]", "x [C]"},
+		},
+		{
+			expr:     "A && B && C && D",
+			selected: []string{"[D] x [C] y [B] z [A]"},
+			skipped:  []string{"[A] [B] [C]"},
+		},
+		{expr: "!(A && B)", err: "negations must apply to the whole selection"},
+		{expr: "A || !B", err: "negations must apply to the whole selection"},
+		{expr: "A && (B || !C)", err: "negations must apply to the whole selection"},
+		{expr: "A && B && C && D && E", err: "more than 4 labels at once"},
+		{expr: "(A || B || C || D || E || F) && (G || H || I || J || K || L)", err: "more than 32 alternatives"},
+		{expr: "A &&", err: "unexpected end"},
+	}
+	for _, test := range tests {
+		focus, skip, err := LabelFocusSkip(test.expr)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("LabelFocusSkip(%q) error = %v, want an error containing %q", test.expr, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LabelFocusSkip(%q) failed: %v", test.expr, err)
+			continue
+		}
+		for _, text := range test.selected {
+			if !selected(focus, skip, text) {
+				t.Errorf("LabelFocusSkip(%q) = %q, %q doesn't select %q", test.expr, focus, skip, text)
+			}
+		}
+		for _, text := range test.skipped {
+			if selected(focus, skip, text) {
+				t.Errorf("LabelFocusSkip(%q) = %q, %q selects %q", test.expr, focus, skip, text)
+			}
+		}
+	}
+}
+
+func TestConjunctionRegexp(t *testing.T) {
+	tests := []struct {
+		regexes []string
+		matched []string
+		other   []string
+	}{
+		{
+			regexes: []string{labelRegexp("A")},
+			matched: []string{"x [A]"},
+			other:   []string{"x A", "x [AB]"},
+		},
+		{
+			regexes: []string{labelRegexp("A"), labelRegexp("B")},
+			matched: []string{"[A] [B]", "[B] x [A]", "[A]\n[B]"},
+			other:   []string{"[A]", "[B]", "[AB]"},
+		},
+		{
+			regexes: []string{labelRegexp("A"), labelRegexp("B"), labelRegexp("Feature:C.D")},
+			matched: []string{"[Feature:C.D] [B] [A]", "[B] [Feature:C.D] x [A]"},
+			other:   []string{"[A] [B] [Feature:CxD]", "[A] [Feature:C.D]"},
+		},
+	}
+	for _, test := range tests {
+		r := regexp.MustCompile(conjunctionRegexp(test.regexes))
+		for _, text := range test.matched {
+			if !r.MatchString(text) {
+				t.Errorf("conjunctionRegexp(%q) = %q doesn't match %q", test.regexes, r, text)
+			}
+		}
+		for _, text := range test.other {
+			if r.MatchString(text) {
+				t.Errorf("conjunctionRegexp(%q) = %q matches %q", test.regexes, r, text)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package framework
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+)
+
+// Label tags a spec, it is encoded into the spec text as "[Label]" so specs
+// can be selected with --labels, or with ginkgo focus and skip regexes.
+type Label string
+
+const (
+	// Serial specs can't run in parallel with other specs. In parallel runs they
+	// are held until all the other specs have finished, see RunSerialSpecs.
+	Serial Label = "Serial"
+	// Slow specs take more than a few minutes.
+	Slow Label = "Slow"
+	// Disruptive specs may break the cluster for other specs, e.g. restart nodes.
+	Disruptive Label = "Disruptive"
+	// Flaky specs are known to fail now and then.
+	Flaky Label = "Flaky"
+	// Conformance specs check the behavior every cluster must have.
+	Conformance Label = "Conformance"
+)
+
+// Feature returns the label of the specs of an optional feature, "[Feature:name]".
+func Feature(name string) Label {
+	return Label("Feature:" + name)
+}
+
+// String returns the label as it appears in spec texts.
+func (l Label) String() string {
+	return "[" + string(l) + "]"
+}
+
+// labelPattern matches the labels of a spec text.
+var labelPattern = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// LabeledText appends the labels to a spec text.
+func LabeledText(text string, labels ...Label) string {
+	for _, label := range labels {
+		text += " " + label.String()
+	}
+	return text
+}
+
+// Labels returns the labels found in a spec text.
+func Labels(text string) []Label {
+	var labels []Label
+	for _, m := range labelPattern.FindAllStringSubmatch(text, -1) {
+		labels = append(labels, Label(m[1]))
+	}
+	return labels
+}
+
+// labeledArgs splits the arguments of Describe, Context and It into the
+// labels and the body.
+func labeledArgs(text string, args []interface{}) (string, interface{}) {
+	var labels []Label
+	var body interface{}
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case Label:
+			labels = append(labels, arg)
+		case func(), func(ginkgo.Done):
+			if body != nil {
+				panic(fmt.Sprintf("%q has two bodies", text))
+			}
+			body = arg
+		default:
+			panic(fmt.Sprintf("%q has an argument of type %T, expected labels and a body", text, arg))
+		}
+	}
+	if body == nil {
+		panic(fmt.Sprintf("%q has no body", text))
+	}
+	return LabeledText(text, labels...), body
+}
+
+// Describe is ginkgo.Describe with labels, e.g.
+//
+//	framework.Describe("Volumes", framework.Serial, framework.Feature("CSI"), func() { ... })
+func Describe(text string, args ...interface{}) bool {
+	text, body := labeledArgs(text, args)
+	return ginkgo.Describe(text, body.(func()))
+}
+
+// Context is ginkgo.Context with labels.
+func Context(text string, args ...interface{}) bool {
+	text, body := labeledArgs(text, args)
+	return ginkgo.Context(text, body.(func()))
+}
+
+// It is ginkgo.It with labels.
+func It(text string, args ...interface{}) bool {
+	text, body := labeledArgs(text, args)
+	return ginkgo.It(text, body)
+}
+
+// labelRegexp returns the regex matching spec texts carrying the label.
+func labelRegexp(label Label) string {
+	return regexp.QuoteMeta(label.String())
+}
+
+// conjunctionRegexp returns a regex matching texts matched by all the given
+// regexes, in any order. Ginkgo regexes are matched anywhere in the text.
+func conjunctionRegexp(regexes []string) string {
+	if len(regexes) == 1 {
+		return regexes[0]
+	}
+	var alternatives []string
+	for i, first := range regexes {
+		rest := append(append([]string{}, regexes[:i]...), regexes[i+1:]...)
+		alternatives = append(alternatives, "(?:"+first+")[\\s\\S]*(?:"+conjunctionRegexp(rest)+")")
+	}
+	return strings.Join(alternatives, "|")
+}
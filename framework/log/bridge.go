@@ -0,0 +1,90 @@
+package log
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// klogLine matches a klog line, "Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg".
+var klogLine = regexp.MustCompile(`^([IWEF])\d{4} \d{2}:\d{2}:\d{2}\.\d{6}\s+\d+ ([^\]]+)\] (.*)$`)
+
+// klogWriter turns the lines written by klog into framework log lines, so they
+// end up in GinkgoWriter next to the output of the spec that caused them.
+type klogWriter struct {
+	logger Logger
+}
+
+func (w klogWriter) Write(b []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		m := klogLine.FindStringSubmatch(line)
+		if m == nil {
+			w.logger.log(LevelInfo, line)
+			continue
+		}
+		level := LevelInfo
+		switch m[1] {
+		case "W":
+			level = LevelWarn
+		case "E", "F":
+			level = LevelError
+		}
+		w.logger.log(level, m[3], "caller", m[2])
+	}
+	return len(b), nil
+}
+
+// RedirectKlog sends the output of klog, used by client-go, to GinkgoWriter
+// instead of stderr. verbosity is the klog -v level, client-go logs its
+// requests from 6 on. Fatal lines still go to stderr as well.
+func RedirectKlog(verbosity int) error {
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	for name, value := range map[string]string{
+		"logtostderr":     "false",
+		"alsologtostderr": "false",
+		"stderrthreshold": "FATAL",
+		"v":               strconv.Itoa(verbosity),
+	} {
+		if err := fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	// klog writes every line to the output of its severity and of all the
+	// lower ones, only keep the info output to get each line once.
+	klog.SetOutputBySeverity("INFO", klogWriter{logger: WithValues("source", "klog")})
+	for _, severity := range []string{"WARNING", "ERROR", "FATAL"} {
+		klog.SetOutputBySeverity(severity, ioutil.Discard)
+	}
+	return nil
+}
+
+// RedirectGlog keeps glog from writing to stderr, where the output of parallel
+// specs interleaves. glog can't write anywhere but stderr and files, so its log
+// files are written to dir instead. Nothing is done if glog isn't linked in.
+func RedirectGlog(dir string) error {
+	if flag.Lookup("log_dir") == nil || flag.Lookup("logtostderr") == nil {
+		return nil
+	}
+	// glog exits if it can't create its log files
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{
+		"log_dir":         dir,
+		"logtostderr":     "false",
+		"alsologtostderr": "false",
+		"stderrthreshold": "FATAL",
+	} {
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
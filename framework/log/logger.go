@@ -1,34 +1,294 @@
 package log
 
 import (
-    "fmt"
-    "github.com/onsi/ginkgo"
-    "github.com/zryfish/framework/framework/ginkgowrapper"
-    "time"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/zryfish/framework/framework/ginkgowrapper"
+	"github.com/zryfish/framework/framework/redact"
 )
 
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelFail is used for failures, they are logged whatever the level.
+const levelFail Level = LevelError + 1
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case levelFail:
+		return "FAIL"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// ParseLevel parses one of debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+}
+
+// Output formats.
+const (
+	// FormatText writes "Jan _2 15:04:05.000: LEVEL: message key=value" lines.
+	FormatText = "text"
+	// FormatJSON writes one JSON object per line with time, level, msg and the fields.
+	FormatJSON = "json"
+)
+
+var (
+	lock     sync.RWMutex
+	minLevel = LevelInfo
+	format   = FormatText
+)
+
+// SetLevel sets the minimum level of the lines written.
+func SetLevel(level Level) {
+	lock.Lock()
+	defer lock.Unlock()
+	minLevel = level
+}
+
+// SetFormat sets the output format, FormatText or FormatJSON.
+func SetFormat(f string) error {
+	if f != FormatText && f != FormatJSON {
+		return fmt.Errorf("unknown log format %q, expected %s or %s", f, FormatText, FormatJSON)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	format = f
+	return nil
+}
+
+// Enabled returns true if lines of the given level are written.
+func Enabled(level Level) bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	return level >= minLevel
+}
+
 func nowStamp() string {
-    return time.Now().Format(time.StampMilli)
+	return time.Now().Format(time.StampMilli)
+}
+
+// Logger writes log lines carrying a set of key-value fields.
+type Logger struct {
+	fields []interface{}
+}
+
+// WithValues returns a logger adding the given key-value pairs to every line.
+func WithValues(keysAndValues ...interface{}) Logger {
+	return Logger{}.WithValues(keysAndValues...)
+}
+
+// WithValues returns a logger adding the given key-value pairs to every line,
+// after the fields of l.
+func (l Logger) WithValues(keysAndValues ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	return Logger{fields: append(fields, keysAndValues...)}
+}
+
+func (l Logger) log(level Level, msg string, keysAndValues ...interface{}) {
+	if level < levelFail && !Enabled(level) {
+		return
+	}
+	fields := redact.Values(append(append([]interface{}{}, l.fields...), keysAndValues...))
+
+	lock.RLock()
+	f := format
+	lock.RUnlock()
+	// lines are redacted before reaching GinkgoWriter, and so every output of the spec
+	if f == FormatJSON {
+		fmt.Fprintln(ginkgo.GinkgoWriter, redact.String(jsonLine(level, msg, fields)))
+		return
+	}
+	fmt.Fprintln(ginkgo.GinkgoWriter, redact.String(nowStamp()+": "+level.String()+": "+msg+textFields(fields)))
+}
+
+func textFields(fields []interface{}) string {
+	var b bytes.Buffer
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(" ")
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteString("=")
+		if i+1 < len(fields) {
+			b.WriteString(textValue(fields[i+1]))
+		} else {
+			b.WriteString("<missing>")
+		}
+	}
+	return b.String()
+}
+
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func jsonLine(level Level, msg string, fields []interface{}) string {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSON(&b, time.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(",")
+		writeJSON(&b, fmt.Sprint(fields[i]))
+		b.WriteString(":")
+		if i+1 < len(fields) {
+			writeJSON(&b, fields[i+1])
+		} else {
+			writeJSON(&b, "<missing>")
+		}
+	}
+	b.WriteString("}")
+	return b.String()
 }
 
-func log(level string, format string, args ...interface{}) {
-    fmt.Fprintf(ginkgo.GinkgoWriter, nowStamp()+": "+level+": "+format+"\n", args...)
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// sprintf formats a log line, with the data of Secrets masked, the values
+// registered with redact are masked once the line is written.
+func sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(format, redact.Values(args)...)
+}
+
+// Debugf logs a debug line.
+func (l Logger) Debugf(format string, args ...interface{}) {
+	l.log(LevelDebug, sprintf(format, args...))
+}
+
+// Logf logs an info line.
+func (l Logger) Logf(format string, args ...interface{}) {
+	l.log(LevelInfo, sprintf(format, args...))
+}
+
+// Warnf logs a warning.
+func (l Logger) Warnf(format string, args ...interface{}) {
+	l.log(LevelWarn, sprintf(format, args...))
+}
+
+// Errorf logs an error.
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.log(LevelError, sprintf(format, args...))
+}
+
+// Debug logs a debug line with key-value fields.
+func (l Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(LevelDebug, msg, keysAndValues...)
+}
+
+// Info logs an info line with key-value fields.
+func (l Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(LevelInfo, msg, keysAndValues...)
+}
+
+// Warn logs a warning with key-value fields.
+func (l Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(LevelWarn, msg, keysAndValues...)
+}
+
+// Error logs an error with key-value fields.
+func (l Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(LevelError, msg, keysAndValues...)
+}
+
+// Debugf logs a debug line.
+func Debugf(format string, args ...interface{}) {
+	Logger{}.log(LevelDebug, sprintf(format, args...))
 }
 
 // Logf logs the info.
-func Logf(format string, args ...interface{})  {
-    log("INFO", format, args...)
+func Logf(format string, args ...interface{}) {
+	Logger{}.log(LevelInfo, sprintf(format, args...))
 }
 
-// Failf logs the fail info.
-func Failf(format string, args ...interface{}) {
+// Warnf logs a warning.
+func Warnf(format string, args ...interface{}) {
+	Logger{}.log(LevelWarn, sprintf(format, args...))
+}
+
+// Errorf logs an error.
+func Errorf(format string, args ...interface{}) {
+	Logger{}.log(LevelError, sprintf(format, args...))
+}
+
+// Debug logs a debug line with key-value fields.
+func Debug(msg string, keysAndValues ...interface{}) {
+	Logger{}.log(LevelDebug, msg, keysAndValues...)
+}
 
+// Info logs an info line with key-value fields.
+func Info(msg string, keysAndValues ...interface{}) {
+	Logger{}.log(LevelInfo, msg, keysAndValues...)
+}
+
+// Warn logs a warning with key-value fields.
+func Warn(msg string, keysAndValues ...interface{}) {
+	Logger{}.log(LevelWarn, msg, keysAndValues...)
+}
+
+// Error logs an error with key-value fields.
+func Error(msg string, keysAndValues ...interface{}) {
+	Logger{}.log(LevelError, msg, keysAndValues...)
+}
+
+// Failf logs the fail info and fails the current spec at the caller of Failf.
+func Failf(format string, args ...interface{}) {
+	FailfWithOffset(1, format, args...)
 }
 
 // FailfWithOffset calls "Fail" and logs the error at "offset" levels above its caller
 // (for example, for call chain f -> g -> FailWithOffset(1, ...) error would be logged for "f").
 func FailfWithOffset(offset int, format string, args ...interface{}) {
-    msg := fmt.Sprintf(format, args...)
-    log("INFO", msg)
-    ginkgowrapper.Fail(nowStamp()+": "+msg, 1+offset)
-}
\ No newline at end of file
+	msg := sprintf(format, args...)
+	Logger{}.log(levelFail, msg)
+	ginkgowrapper.Fail(nowStamp()+": "+redact.String(msg), 1+offset)
+}
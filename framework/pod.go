@@ -0,0 +1,60 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// WaitForPodRunning waits for a pod to be running with all its containers ready.
+func WaitForPodRunning(c clientset.Interface, namespace, podName string, timeout time.Duration) (*v1.Pod, error) {
+	return waitForPodRunning(suiteContext, c, namespace, podName, timeouts.Poll, timeout)
+}
+
+// WaitForPodRunning waits for a pod of the framework namespace to be running
+// with all its containers ready.
+func (f *Framework) WaitForPodRunning(podName string) (*v1.Pod, error) {
+	return f.WaitForPodRunningInNamespace(f.Namespace.Name, podName)
+}
+
+// WaitForPodRunningInNamespace waits for a pod to be running with all its containers ready.
+func (f *Framework) WaitForPodRunningInNamespace(namespace, podName string) (*v1.Pod, error) {
+	return waitForPodRunning(f.Context(), f.ClientSet, namespace, podName, f.Timeouts.Poll, f.Timeouts.PodStart)
+}
+
+func waitForPodRunning(ctx context.Context, c clientset.Interface, namespace, podName string, poll, timeout time.Duration) (*v1.Pod, error) {
+	var pod *v1.Pod
+	err := pollImmediate(ctx, poll, timeout, func() (bool, error) {
+		var err error
+		pod, err = c.CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+		if err != nil {
+			Logf("Failed to get pod %s/%s, retrying in %v: %v", namespace, podName, poll, err)
+			return false, nil
+		}
+		switch pod.Status.Phase {
+		case v1.PodFailed, v1.PodSucceeded:
+			return false, fmt.Errorf("pod %s/%s terminated: %s", namespace, podName, pod.Status.Phase)
+		case v1.PodRunning:
+			return podReady(pod), nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return pod, fmt.Errorf("error waiting for pod %s/%s to be running: %v", namespace, podName, err)
+	}
+	return pod, nil
+}
+
+// podReady returns true if the ready condition of a pod is true.
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
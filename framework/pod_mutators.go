@@ -0,0 +1,125 @@
+package framework
+
+import (
+	"sync"
+
+	"k8s.io/api/core/v1"
+)
+
+// PodSpecMutator changes the spec of the pods the framework creates, e.g. to
+// add the tolerations or the security context an environment requires.
+type PodSpecMutator func(spec *v1.PodSpec)
+
+// podSettings is the pods section of the config file, defaults applied to the
+// spec of every pod the framework creates, e.g.
+//
+//	pods:
+//	  nodeSelector:
+//	    pool: e2e
+//	  tolerations:
+//	  - key: dedicated
+//	    operator: Exists
+//	  runtimeClassName: gvisor
+//	  securityContext:
+//	    runAsNonRoot: true
+//	  containerSecurityContext:
+//	    allowPrivilegeEscalation: false
+type podSettings struct {
+	// NodeSelector labels are added unless the pod selects another value.
+	NodeSelector map[string]string `json:"nodeSelector"`
+	// Tolerations are added.
+	Tolerations []v1.Toleration `json:"tolerations"`
+	// RuntimeClassName is set unless the pod has one.
+	RuntimeClassName string `json:"runtimeClassName"`
+	// SecurityContext is set unless the pod has one.
+	SecurityContext *v1.PodSecurityContext `json:"securityContext"`
+	// ContainerSecurityContext is set on the containers without one.
+	ContainerSecurityContext *v1.SecurityContext `json:"containerSecurityContext"`
+}
+
+var (
+	// podConfig is decoded from the config file.
+	podConfig podSettings
+
+	podMutatorsLock sync.Mutex
+	podMutators     []PodSpecMutator
+)
+
+// RegisterPodSpecMutator registers a mutator of the spec of every pod the
+// framework creates, e.g. by a suite in an init func. Mutators run in the
+// order they are registered, after the defaults of the pods section of the
+// config file, and before the mutators of the framework of the spec.
+func RegisterPodSpecMutator(mutator PodSpecMutator) {
+	podMutatorsLock.Lock()
+	defer podMutatorsLock.Unlock()
+	podMutators = append(podMutators, mutator)
+}
+
+// MutatePodSpec applies the image pull secret and the defaults of the config
+// file, and the registered mutators, to a pod spec. Pods created without a framework, e.g. before the
+// suite, must be passed to it.
+func MutatePodSpec(spec *v1.PodSpec) {
+	addPullSecret(spec)
+	podConfig.apply(spec)
+	podMutatorsLock.Lock()
+	mutators := append([]PodSpecMutator{}, podMutators...)
+	podMutatorsLock.Unlock()
+	for _, mutate := range mutators {
+		mutate(spec)
+	}
+}
+
+// AddPodSpecMutator registers a mutator of the pods created by the framework
+// in the running spec, it is removed in AfterEach.
+func (f *Framework) AddPodSpecMutator(mutator PodSpecMutator) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.podMutators = append(f.podMutators, mutator)
+}
+
+// MutatePodSpec applies the global mutators, see MutatePodSpec, then the
+// mutators of the framework to a pod spec. The builders, and the pods of the
+// framework helpers, are mutated already, pods created directly by specs must
+// be passed to it.
+func (f *Framework) MutatePodSpec(spec *v1.PodSpec) {
+	MutatePodSpec(spec)
+	f.lock.Lock()
+	mutators := append([]PodSpecMutator{}, f.podMutators...)
+	f.lock.Unlock()
+	for _, mutate := range mutators {
+		mutate(spec)
+	}
+}
+
+// apply applies the defaults of the pods section of the config file.
+func (s podSettings) apply(spec *v1.PodSpec) {
+	for k, v := range s.NodeSelector {
+		if _, ok := spec.NodeSelector[k]; ok {
+			continue
+		}
+		if spec.NodeSelector == nil {
+			spec.NodeSelector = map[string]string{}
+		}
+		spec.NodeSelector[k] = v
+	}
+	spec.Tolerations = append(spec.Tolerations, s.Tolerations...)
+	if s.RuntimeClassName != "" && spec.RuntimeClassName == nil {
+		name := s.RuntimeClassName
+		spec.RuntimeClassName = &name
+	}
+	if s.SecurityContext != nil && spec.SecurityContext == nil {
+		spec.SecurityContext = s.SecurityContext.DeepCopy()
+	}
+	if s.ContainerSecurityContext != nil {
+		for i := range spec.InitContainers {
+			if spec.InitContainers[i].SecurityContext == nil {
+				spec.InitContainers[i].SecurityContext = s.ContainerSecurityContext.DeepCopy()
+			}
+		}
+		for i := range spec.Containers {
+			if spec.Containers[i].SecurityContext == nil {
+				spec.Containers[i].SecurityContext = s.ContainerSecurityContext.DeepCopy()
+			}
+		}
+	}
+}
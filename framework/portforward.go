@@ -0,0 +1,365 @@
+package framework
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// portForwardDialTimeout bounds the wait for a reconnecting port forward when
+// a local connection is accepted.
+const portForwardDialTimeout = 30 * time.Second
+
+// PortForward forwards a local address to a port of a pod. When the
+// connection to the pod is lost, or the pod is deleted, replaced or no longer
+// ready, it reconnects to the pod, or to a new pod backing the service, on the
+// same local address.
+type PortForward struct {
+	// Addr is the forwarded local address, "127.0.0.1:port".
+	Addr string
+
+	client    clientset.Interface
+	config    *restclient.Config
+	poll      time.Duration
+	namespace string
+	target    string
+	resolve   func() (portForwardTarget, error)
+	listener  net.Listener
+
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	lock sync.Mutex
+	// forwarded is the local address of the current forward to the pod, "" while reconnecting.
+	forwarded string
+	err       error
+}
+
+// portForwardTarget is the pod a port forward is connected to.
+type portForwardTarget struct {
+	pod  string
+	uid  types.UID
+	port int
+	// ready requires the pod to stay ready, as the pods backing a service.
+	ready bool
+}
+
+// PortForwardToPod forwards a local address to a port of a pod of the
+// framework namespace. The forward is closed in AfterEach.
+func (f *Framework) PortForwardToPod(podName string, port int) (*PortForward, error) {
+	namespace := f.Namespace.Name
+	client := f.ClientSet
+	return f.portForward(namespace, fmt.Sprintf("pod %s/%s port %d", namespace, podName, port), func() (portForwardTarget, error) {
+		pod, err := client.CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+		if err != nil {
+			return portForwardTarget{}, err
+		}
+		if pod.Status.Phase != v1.PodRunning {
+			return portForwardTarget{}, fmt.Errorf("pod %s/%s is %s", namespace, podName, pod.Status.Phase)
+		}
+		if pod.DeletionTimestamp != nil {
+			return portForwardTarget{}, fmt.Errorf("pod %s/%s is being deleted", namespace, podName)
+		}
+		return portForwardTarget{pod: pod.Name, uid: pod.UID, port: port}, nil
+	})
+}
+
+// PortForwardToService forwards a local address to a port of a service of the
+// framework namespace, through a ready pod backing the service. The forward is
+// closed in AfterEach.
+func (f *Framework) PortForwardToService(serviceName string, port int) (*PortForward, error) {
+	namespace := f.Namespace.Name
+	client := f.ClientSet
+	return f.portForward(namespace, fmt.Sprintf("service %s/%s port %d", namespace, serviceName, port), func() (portForwardTarget, error) {
+		return serviceBackend(client, namespace, serviceName, port)
+	})
+}
+
+// serviceBackend returns a ready pod backing a service port, and its target port.
+func serviceBackend(c clientset.Interface, namespace, serviceName string, port int) (portForwardTarget, error) {
+	service, err := c.CoreV1().Services(namespace).Get(serviceName, metav1.GetOptions{})
+	if err != nil {
+		return portForwardTarget{}, err
+	}
+	var servicePort *v1.ServicePort
+	for i := range service.Spec.Ports {
+		if int(service.Spec.Ports[i].Port) == port {
+			servicePort = &service.Spec.Ports[i]
+		}
+	}
+	if servicePort == nil {
+		return portForwardTarget{}, fmt.Errorf("service %s/%s has no port %d", namespace, serviceName, port)
+	}
+
+	endpoints, err := c.CoreV1().Endpoints(namespace).Get(serviceName, metav1.GetOptions{})
+	if err != nil {
+		return portForwardTarget{}, err
+	}
+	for _, subset := range endpoints.Subsets {
+		for _, endpointPort := range subset.Ports {
+			if endpointPort.Name != servicePort.Name {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+					return portForwardTarget{pod: address.TargetRef.Name, uid: address.TargetRef.UID, port: int(endpointPort.Port), ready: true}, nil
+				}
+			}
+		}
+	}
+	return portForwardTarget{}, fmt.Errorf("service %s/%s has no ready pod for port %d", namespace, serviceName, port)
+}
+
+// portForward listens on a local address and forwards it to the pod of
+// namespace returned by resolve. It returns once the first forward is ready.
+func (f *Framework) portForward(namespace, target string, resolve func() (portForwardTarget, error)) (*PortForward, error) {
+	config, err := f.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading the client config: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error listening for the port forward to %s: %v", target, err)
+	}
+	pf := &PortForward{
+		Addr:      listener.Addr().String(),
+		client:    f.ClientSet,
+		config:    config,
+		poll:      f.Timeouts.Poll,
+		namespace: namespace,
+		target:    target,
+		resolve:   resolve,
+		listener:  listener,
+		stop:      make(chan struct{}),
+	}
+	f.lock.Lock()
+	f.portForwards = append(f.portForwards, pf)
+	f.lock.Unlock()
+
+	go pf.run()
+	go pf.accept()
+
+	err = pollImmediate(f.Context(), f.Timeouts.Poll, f.Timeouts.PodStart, func() (bool, error) {
+		forwarded, _ := pf.current()
+		return forwarded != "", nil
+	})
+	if err != nil {
+		_, lastErr := pf.current()
+		pf.Close()
+		return nil, fmt.Errorf("error forwarding to %s: %v, last error: %v", target, err, lastErr)
+	}
+	Logf("Forwarding %s to %s", pf.Addr, target)
+	return pf, nil
+}
+
+// Close stops the port forward.
+func (pf *PortForward) Close() {
+	pf.closeOnce.Do(func() {
+		close(pf.stop)
+		pf.listener.Close()
+	})
+}
+
+func (pf *PortForward) current() (string, error) {
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+	return pf.forwarded, pf.err
+}
+
+func (pf *PortForward) set(forwarded string, err error) {
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+	pf.forwarded, pf.err = forwarded, err
+}
+
+// run forwards to the pod of the target until the forward is closed,
+// reconnecting when the connection is lost or the pod changes.
+func (pf *PortForward) run() {
+	for {
+		target, err := pf.resolve()
+		if err == nil {
+			err = pf.forward(target)
+		}
+		pf.set("", err)
+
+		select {
+		case <-pf.stop:
+			return
+		case <-time.After(pf.poll):
+		}
+		Logf("Port forward to %s failed, reconnecting: %v", pf.target, err)
+	}
+}
+
+// forward forwards a random local port to a port of a pod, until the
+// connection to the pod is lost, the pod changes or the forward is closed.
+func (pf *PortForward) forward(target portForwardTarget) error {
+	req := pf.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pf.namespace).
+		Name(target.pod).
+		SubResource("portforward")
+	transport, upgrader, err := spdy.RoundTripperFor(pf.config)
+	if err != nil {
+		return err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	// ForwardPorts doesn't return when the pod goes away, it is stopped when the pod changes
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopForward := func() { stopOnce.Do(func() { close(stop) }) }
+	ready := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", target.port)}, stop, ready, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		done <- forwarder.ForwardPorts()
+		close(finished)
+	}()
+	changed := make(chan error, 1)
+	go func() {
+		defer stopForward()
+		for {
+			select {
+			case <-pf.stop:
+				return
+			case <-finished:
+				return
+			case <-time.After(pf.poll):
+			}
+			if err := pf.changed(target); err != nil {
+				changed <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return pf.lost(target, err, changed)
+	case <-ready:
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		stopForward()
+		<-done
+		return err
+	}
+	pf.set(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(ports[0].Local))), nil)
+	return pf.lost(target, <-done, changed)
+}
+
+// lost returns why the forward to the pod of target ended with err, nil when
+// the port forward was closed.
+func (pf *PortForward) lost(target portForwardTarget, err error, changed chan error) error {
+	select {
+	case err := <-changed:
+		return err
+	default:
+	}
+	select {
+	case <-pf.stop:
+		return nil
+	default:
+	}
+	if err == nil {
+		err = fmt.Errorf("connection to pod %s lost", target.pod)
+	}
+	return err
+}
+
+// changed returns an error if the pod of target was deleted or replaced, is no
+// longer running, or no longer ready when it backs a service. Errors getting
+// the pod are ignored, the connection is kept until the pod is known to change.
+func (pf *PortForward) changed(target portForwardTarget) error {
+	pod, err := pf.client.CoreV1().Pods(pf.namespace).Get(target.pod, metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		return fmt.Errorf("pod %s was deleted", target.pod)
+	}
+	if err != nil {
+		return nil
+	}
+	switch {
+	case target.uid != "" && pod.UID != target.uid:
+		return fmt.Errorf("pod %s was replaced", target.pod)
+	case pod.DeletionTimestamp != nil:
+		return fmt.Errorf("pod %s is being deleted", target.pod)
+	case pod.Status.Phase != v1.PodRunning:
+		return fmt.Errorf("pod %s is %s", target.pod, pod.Status.Phase)
+	case target.ready && !podReady(pod):
+		return fmt.Errorf("pod %s is no longer ready", target.pod)
+	}
+	return nil
+}
+
+// accept proxies the local connections to the current forward.
+func (pf *PortForward) accept() {
+	for {
+		conn, err := pf.listener.Accept()
+		if err != nil {
+			// closed
+			return
+		}
+		go pf.proxy(conn)
+	}
+}
+
+func (pf *PortForward) proxy(conn net.Conn) {
+	defer conn.Close()
+
+	var forwarded string
+	deadline := time.Now().Add(portForwardDialTimeout)
+	for {
+		forwarded, _ = pf.current()
+		if forwarded != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			Logf("Port forward to %s isn't connected, closing the connection from %s", pf.target, conn.RemoteAddr())
+			return
+		}
+		select {
+		case <-pf.stop:
+			return
+		case <-time.After(pf.poll):
+		}
+	}
+
+	upstream, err := net.Dial("tcp", forwarded)
+	if err != nil {
+		Logf("Port forward to %s failed to connect: %v", pf.target, err)
+		return
+	}
+	defer upstream.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-pf.stop:
+	}
+}
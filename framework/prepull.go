@@ -0,0 +1,207 @@
+package framework
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zryfish/framework/framework/image"
+	"github.com/zryfish/framework/framework/junit"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// prePullName is the name of the pre-pull daemon set, and the base name of its namespace.
+const prePullName = "image-prepull"
+
+var (
+	prePullLock sync.Mutex
+	// prePullFailures are the images which failed to pull, by node.
+	prePullFailures = map[string][]string{}
+)
+
+// imagePullFailures are the container waiting reasons of failed pulls.
+var imagePullFailures = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// PrePullImages pulls every image of the image registry onto the schedulable
+// nodes, with a daemon set of one container per image, so the first specs
+// don't time out pulling images. It logs the progress of every node, and
+// returns once every image is pulled or failed to pull on every node. Nodes
+// failing to pull are logged and reported, they don't fail the suite.
+func PrePullImages(c clientset.Interface) error {
+	if !TestContext.PrePullImages {
+		return nil
+	}
+	ctx := suiteContext
+	ns, err := createTestingNS(ctx, prePullName, c, nil, &timeouts)
+	if ns != nil {
+		// not waiting for the deletion, the pulled images stay on the nodes
+		defer func() {
+			if err := c.CoreV1().Namespaces().Delete(ns.Name, &metav1.DeleteOptions{}); err != nil {
+				Logf("Failed to delete the image pre-pull namespace %s: %v", ns.Name, err)
+			}
+		}()
+	}
+	if err != nil {
+		return fmt.Errorf("error creating the image pre-pull namespace: %v", err)
+	}
+
+	images := image.All()
+	daemonSet := prePullDaemonSet(images)
+	MutatePodSpec(&daemonSet.Spec.Template.Spec)
+	if _, err := c.AppsV1().DaemonSets(ns.Name).Create(daemonSet); err != nil {
+		return fmt.Errorf("error creating the image pre-pull daemon set: %v", err)
+	}
+	Logf("Pre-pulling %d images: %s", len(images), strings.Join(images, ", "))
+
+	progress := map[string]string{}
+	var failures map[string][]string
+	err = pollImmediate(ctx, timeouts.Poll, timeouts.ImagePrePull, func() (bool, error) {
+		ds, err := c.AppsV1().DaemonSets(ns.Name).Get(prePullName, metav1.GetOptions{})
+		if err != nil {
+			Logf("Failed to get the image pre-pull daemon set, retrying in %v: %v", timeouts.Poll, err)
+			return false, nil
+		}
+		pods, err := c.CoreV1().Pods(ns.Name).List(metav1.ListOptions{})
+		if err != nil {
+			Logf("Failed to list the image pre-pull pods, retrying in %v: %v", timeouts.Poll, err)
+			return false, nil
+		}
+
+		done := 0
+		failures = map[string][]string{}
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName == "" {
+				continue
+			}
+			pulled, failed := pullStatus(&pod)
+			if pulled+len(failed) == len(images) {
+				done++
+			}
+			if len(failed) > 0 {
+				failures[pod.Spec.NodeName] = failed
+			}
+			status := fmt.Sprintf("%d/%d images pulled", pulled, len(images))
+			if len(failed) > 0 {
+				status += fmt.Sprintf(", %d failed", len(failed))
+			}
+			if progress[pod.Spec.NodeName] != status {
+				progress[pod.Spec.NodeName] = status
+				Logf("Node %s: %s", pod.Spec.NodeName, status)
+			}
+		}
+		return ds.Status.DesiredNumberScheduled > 0 && done >= int(ds.Status.DesiredNumberScheduled), nil
+	})
+	recordPrePullFailures(failures)
+	if err != nil {
+		return fmt.Errorf("error waiting for the images to be pulled: %v", err)
+	}
+	Logf("Pre-pulled the images on %d nodes", len(progress))
+	return nil
+}
+
+// prePullToolsDir is where the pre-pull containers mount the busybox binary
+// they run, the images may have no shell or sleep of their own.
+const prePullToolsDir = "/prepull-tools"
+
+func prePullDaemonSet(images []string) *appsv1.DaemonSet {
+	labels := map[string]string{"name": prePullName}
+	toolsMount := v1.VolumeMount{Name: "tools", MountPath: prePullToolsDir}
+	var containers []v1.Container
+	for i, reference := range images {
+		containers = append(containers, v1.Container{
+			Name:  fmt.Sprintf("image-%d", i),
+			Image: reference,
+			// the static busybox binary keeps the container running, whatever
+			// the image, so the pods don't crash-loop once the images are pulled
+			Command:         []string{prePullToolsDir + "/busybox", "sleep", "2147483647"},
+			ImagePullPolicy: v1.PullIfNotPresent,
+			VolumeMounts:    []v1.VolumeMount{toolsMount},
+		})
+	}
+	var gracePeriod int64
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: prePullName},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					InitContainers: []v1.Container{{
+						Name:            "tools",
+						Image:           image.Get(image.Busybox),
+						Command:         []string{"cp", "/bin/busybox", prePullToolsDir + "/busybox"},
+						ImagePullPolicy: v1.PullIfNotPresent,
+						VolumeMounts:    []v1.VolumeMount{toolsMount},
+					}},
+					Containers:                    containers,
+					TerminationGracePeriodSeconds: &gracePeriod,
+					Volumes: []v1.Volume{{
+						Name:         "tools",
+						VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// pullStatus returns the number of images of a pod pulled, they have an image
+// id once their container was created, and the images which failed to pull.
+// The images of the containers are counted as failed when the pull of the
+// image of the init container failed, as the containers can't start then.
+func pullStatus(pod *v1.Pod) (int, []string) {
+	pulled := 0
+	var failed []string
+	initFailed := false
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.ImageID == "" && status.State.Waiting != nil && imagePullFailures[status.State.Waiting.Reason] {
+			initFailed = true
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		switch {
+		case status.ImageID != "":
+			pulled++
+		case status.State.Waiting != nil && imagePullFailures[status.State.Waiting.Reason]:
+			failed = append(failed, fmt.Sprintf("%s (%s)", status.Image, status.State.Waiting.Reason))
+		case initFailed:
+			failed = append(failed, fmt.Sprintf("%s (%s failed to pull)", status.Image, image.Get(image.Busybox)))
+		}
+	}
+	return pulled, failed
+}
+
+// recordPrePullFailures logs the images which failed to pull, and keeps them for the report.
+func recordPrePullFailures(failures map[string][]string) {
+	prePullLock.Lock()
+	defer prePullLock.Unlock()
+	for node, images := range failures {
+		Logf("Node %s failed to pull %s", node, strings.Join(images, ", "))
+		prePullFailures[node] = images
+	}
+}
+
+// prePullProperties returns the images which failed to pull as report properties.
+func prePullProperties() []junit.Property {
+	prePullLock.Lock()
+	defer prePullLock.Unlock()
+	var nodes []string
+	for node := range prePullFailures {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	var properties []junit.Property
+	for _, node := range nodes {
+		properties = append(properties, junit.Property{Name: "ImagePullFailure", Value: node + ": " + strings.Join(prePullFailures[node], ", ")})
+	}
+	return properties
+}
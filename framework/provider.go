@@ -0,0 +1,138 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Capability is a feature of the environment under test that specs may depend on.
+type Capability string
+
+const (
+	// CapabilityNodeAccess means commands can be run on the nodes with ExecOnNode.
+	CapabilityNodeAccess Capability = "NodeAccess"
+	// CapabilityLoadBalancer means services of type LoadBalancer get an external address.
+	CapabilityLoadBalancer Capability = "LoadBalancer"
+	// CapabilityDynamicProvisioning means claims of the default storage class are provisioned.
+	CapabilityDynamicProvisioning Capability = "DynamicProvisioning"
+	// CapabilityMultiNode means the cluster has more than one schedulable node.
+	CapabilityMultiNode Capability = "MultiNode"
+)
+
+// ErrNotSupported is returned by the providers for the operations the environment doesn't support.
+var ErrNotSupported = errors.New("not supported by the provider")
+
+// ProviderInterface is what the framework knows about the environment the
+// suite runs against. Specs ask Provider() what the environment supports
+// instead of hard-coding assumptions.
+type ProviderInterface interface {
+	// Name returns the name the provider is registered with.
+	Name() string
+
+	// Setup prepares the environment, it runs once on ginkgo node 1 before the specs.
+	Setup() error
+	// Teardown cleans up the environment, it runs once on ginkgo node 1 after the specs.
+	Teardown() error
+
+	// ExecOnNode runs a shell command on a node and returns its output.
+	ExecOnNode(node, command string) (string, error)
+	// DefaultStorageClass returns the storage class specs should use, "" for the cluster default.
+	DefaultStorageClass() string
+	// Capabilities returns the features of the environment.
+	Capabilities() []Capability
+}
+
+// NullProvider is the default implementation of ProviderInterface, for an
+// environment about which nothing is known. Providers embed it.
+type NullProvider struct{}
+
+func (n NullProvider) Name() string {
+	return ""
+}
+
+func (n NullProvider) Setup() error {
+	return nil
+}
+
+func (n NullProvider) Teardown() error {
+	return nil
+}
+
+func (n NullProvider) ExecOnNode(node, command string) (string, error) {
+	return "", fmt.Errorf("running a command on node %s: %v", node, ErrNotSupported)
+}
+
+func (n NullProvider) DefaultStorageClass() string {
+	return ""
+}
+
+func (n NullProvider) Capabilities() []Capability {
+	return nil
+}
+
+var _ ProviderInterface = NullProvider{}
+
+// ProviderFactory creates a provider, it is called once the flags are read.
+type ProviderFactory func() (ProviderInterface, error)
+
+var (
+	providersLock sync.Mutex
+	providers                       = map[string]ProviderFactory{}
+	provider      ProviderInterface = NullProvider{}
+)
+
+// RegisterProvider registers a provider under a name, to be selected with --provider.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("provider %q registered twice", name))
+	}
+	providers[name] = factory
+}
+
+// ProviderNames returns the names of the registered providers, sorted.
+func ProviderNames() []string {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setupProvider creates the provider registered under name.
+func setupProvider(name string) error {
+	providersLock.Lock()
+	factory, ok := providers[name]
+	providersLock.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown provider %q, expected one of %s", name, strings.Join(ProviderNames(), ", "))
+	}
+	p, err := factory()
+	if err != nil {
+		return fmt.Errorf("error creating provider %s: %v", name, err)
+	}
+	provider = p
+	return nil
+}
+
+// Provider returns the provider selected with --provider.
+func Provider() ProviderInterface {
+	return provider
+}
+
+// HasCapability returns true if the provider supports the capability.
+func HasCapability(capability Capability) bool {
+	for _, c := range Provider().Capabilities() {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package framework
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	RegisterProvider("local", func() (ProviderInterface, error) {
+		return localProvider{}, nil
+	})
+	RegisterProvider("localcluster", func() (ProviderInterface, error) {
+		return localClusterProvider{runtime: "docker"}, nil
+	})
+}
+
+// localProvider is an existing cluster reached through the kubeconfig, or the
+// in-cluster config, about which nothing else is known.
+type localProvider struct {
+	NullProvider
+}
+
+func (p localProvider) Name() string {
+	return "local"
+}
+
+// localClusterProvider is a cluster whose nodes are containers on this host,
+// as created by kind, named after the nodes.
+type localClusterProvider struct {
+	NullProvider
+
+	// runtime is the container runtime CLI used to reach the nodes.
+	runtime string
+}
+
+func (p localClusterProvider) Name() string {
+	return "localcluster"
+}
+
+func (p localClusterProvider) Setup() error {
+	if out, err := exec.Command(p.runtime, "version").CombinedOutput(); err != nil {
+		return fmt.Errorf("localcluster provider needs %s to reach the nodes: %v\n%s", p.runtime, err, out)
+	}
+	return nil
+}
+
+func (p localClusterProvider) ExecOnNode(node, command string) (string, error) {
+	out, err := exec.Command(p.runtime, "exec", node, "sh", "-c", command).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("error running %q on node %s: %v\n%s", command, node, err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (p localClusterProvider) DefaultStorageClass() string {
+	return "standard"
+}
+
+func (p localClusterProvider) Capabilities() []Capability {
+	return []Capability{CapabilityNodeAccess, CapabilityDynamicProvisioning}
+}
@@ -0,0 +1,114 @@
+package framework
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"github.com/zryfish/framework/framework/junit"
+	e2elog "github.com/zryfish/framework/framework/log"
+	"sigs.k8s.io/yaml"
+)
+
+// quarantineDateFormat is the format of the expiry date of a quarantine entry.
+const quarantineDateFormat = "2006-01-02"
+
+// QuarantineEntry quarantines the specs matching a regular expression. Quarantined
+// specs still run, but their failures don't fail the suite.
+type QuarantineEntry struct {
+	// Spec is a regular expression matched against the full spec text.
+	Spec string `json:"spec"`
+	// Reason explains why the specs are quarantined.
+	Reason string `json:"reason"`
+	// Issue tracks the fix of the specs.
+	Issue string `json:"issue,omitempty"`
+	// Expires is the date, as YYYY-MM-DD, after which the entry should be revisited.
+	Expires string `json:"expires,omitempty"`
+
+	pattern *regexp.Regexp
+	expires time.Time
+}
+
+// Quarantine is the list of quarantined specs loaded from the quarantine file.
+type Quarantine struct {
+	Entries []QuarantineEntry `json:"quarantine"`
+}
+
+// LoadQuarantine reads and validates a quarantine file.
+func LoadQuarantine(path string) (*Quarantine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading quarantine file: %v", err)
+	}
+	q := &Quarantine{}
+	if err := yaml.UnmarshalStrict(data, q); err != nil {
+		return nil, fmt.Errorf("error parsing quarantine file %s: %v", path, err)
+	}
+
+	for i := range q.Entries {
+		entry := &q.Entries[i]
+		if entry.Spec == "" {
+			return nil, fmt.Errorf("quarantine entry %d in %s has no spec", i, path)
+		}
+		if entry.Reason == "" {
+			return nil, fmt.Errorf("quarantine entry %q in %s has no reason", entry.Spec, path)
+		}
+		if entry.pattern, err = regexp.Compile(entry.Spec); err != nil {
+			return nil, fmt.Errorf("quarantine entry %q in %s has an invalid spec regex: %v", entry.Spec, path, err)
+		}
+		if entry.Expires != "" {
+			if entry.expires, err = time.Parse(quarantineDateFormat, entry.Expires); err != nil {
+				return nil, fmt.Errorf("quarantine entry %q in %s has an invalid expiry date, expected YYYY-MM-DD: %v", entry.Spec, path, err)
+			}
+		}
+	}
+	return q, nil
+}
+
+// Expired returns true if the entry expiry date is in the past.
+func (e *QuarantineEntry) Expired(now time.Time) bool {
+	// an entry is valid until the end of its expiry date
+	return !e.expires.IsZero() && now.After(e.expires.AddDate(0, 0, 1))
+}
+
+// Match returns the first entry matching the spec text.
+func (q *Quarantine) Match(spec string) (*QuarantineEntry, bool) {
+	if q == nil {
+		return nil, false
+	}
+	for i := range q.Entries {
+		if q.Entries[i].pattern.MatchString(spec) {
+			return &q.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// WarnExpired logs a warning for every expired entry. Expired entries still apply.
+func (q *Quarantine) WarnExpired() {
+	if q == nil {
+		return
+	}
+	now := time.Now()
+	for _, entry := range q.Entries {
+		if entry.Expired(now) {
+			e2elog.Warnf("quarantine of %q expired on %s (reason: %s, issue: %s), fix or remove the entry", entry.Spec, entry.Expires, entry.Reason, entry.Issue)
+		}
+	}
+}
+
+// Quarantined is a junit.QuarantineFunc using the quarantine loaded in TestContext.
+func Quarantined(spec string) (junit.QuarantinedSpec, bool) {
+	entry, ok := TestContext.Quarantine.Match(spec)
+	if !ok {
+		return junit.QuarantinedSpec{}, false
+	}
+	return junit.QuarantinedSpec{
+		Name:    spec,
+		Reason:  entry.Reason,
+		Issue:   entry.Issue,
+		Expires: entry.Expires,
+		Expired: entry.Expired(time.Now()),
+	}, true
+}
@@ -0,0 +1,214 @@
+// Package redact masks credentials before they reach logs, artifacts and
+// reports: bearer tokens, service account tokens, kubeconfig credentials,
+// Secret data and any value registered as secret.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Mask replaces redacted values.
+const Mask = "<redacted>"
+
+// minSecretLength is the length under which registered values are ignored,
+// masking them would mangle unrelated text.
+const minSecretLength = 4
+
+// credentialKeys are the keys whose values are credentials, in kubeconfigs,
+// docker configs and the like.
+const credentialKeys = `token|id-token|refresh-token|access-token|client-key-data|password|client-secret|auth`
+
+var (
+	patterns = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		// Authorization: Bearer <token>
+		{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9\-._~+/]+=*`), "${1}" + Mask},
+		// service account tokens and other JWTs
+		{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]*`), Mask},
+		// "token": "value"
+		{regexp.MustCompile(`("(?:` + credentialKeys + `)"\s*:\s*")(?:[^"\\]|\\.)*(")`), "${1}" + Mask + "${2}"},
+		// token: value
+		{regexp.MustCompile(`(?m)^(\s*(?:-\s+)?(?:` + credentialKeys + `):[ \t]+)\S.*$`), "${1}" + Mask},
+		// --token=value
+		{regexp.MustCompile(`(--(?:token|password)[= ])\S+`), "${1}" + Mask},
+	}
+	credentialKey = regexp.MustCompile(`^(?:` + credentialKeys + `)$`)
+
+	lock       sync.RWMutex
+	secrets    []string
+	registered = map[string]bool{}
+)
+
+// Register adds values masked wherever they appear, e.g. the credentials of
+// the rest config. Values shorter than 4 characters are ignored. It is called
+// for every request of the clients, the values registered already only take
+// the read lock.
+func Register(values ...string) {
+	if !unregistered(values) {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	added := false
+	for _, v := range values {
+		if len(v) < minSecretLength || registered[v] {
+			continue
+		}
+		registered[v] = true
+		secrets = append(secrets, v)
+		added = true
+	}
+	if !added {
+		return
+	}
+	// mask the longest values first, in case one contains another
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// unregistered returns true if some of the values have to be registered.
+func unregistered(values []string) bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, v := range values {
+		if len(v) >= minSecretLength && !registered[v] {
+			return true
+		}
+	}
+	return false
+}
+
+// String masks the credentials found in s.
+func String(s string) string {
+	lock.RLock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Mask, -1)
+	}
+	lock.RUnlock()
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// Bytes masks the credentials found in b.
+func Bytes(b []byte) []byte {
+	return []byte(String(string(b)))
+}
+
+// JSON masks the credentials of a JSON document: the data of Secrets, the
+// values of credential keys and then what String masks. Documents that don't
+// parse are masked with String only.
+func JSON(data []byte) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Bytes(data)
+	}
+	redactValue(doc)
+	var masked bytes.Buffer
+	encoder := json.NewEncoder(&masked)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return Bytes(data)
+	}
+	return Bytes(masked.Bytes())
+}
+
+func redactValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch v["kind"] {
+		case "Secret":
+			maskValues(v["data"])
+			maskValues(v["stringData"])
+		case "SecretList":
+			// the items of typed lists have no kind
+			if items, ok := v["items"].([]interface{}); ok {
+				for _, item := range items {
+					if m, ok := item.(map[string]interface{}); ok {
+						maskValues(m["data"])
+						maskValues(m["stringData"])
+					}
+				}
+			}
+		}
+		for key, value := range v {
+			if _, ok := value.(string); ok && credentialKey.MatchString(key) {
+				v[key] = Mask
+				continue
+			}
+			redactValue(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactValue(item)
+		}
+	}
+}
+
+func maskValues(v interface{}) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for key := range m {
+			m[key] = Mask
+		}
+	}
+}
+
+// Secret returns a copy of secret with its data masked, to be logged or dumped.
+func Secret(secret *v1.Secret) *v1.Secret {
+	masked := secret.DeepCopy()
+	for key := range masked.Data {
+		masked.Data[key] = []byte(Mask)
+	}
+	for key := range masked.StringData {
+		masked.StringData[key] = Mask
+	}
+	return masked
+}
+
+// Value returns v with the data of Secrets masked, to be formatted into a log
+// line: Secrets, and lists of Secrets, are replaced by masked copies, other
+// values are returned as is.
+func Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *v1.Secret:
+		if v != nil {
+			return Secret(v)
+		}
+	case v1.Secret:
+		return *Secret(&v)
+	case *v1.SecretList:
+		if v != nil {
+			return secretList(v)
+		}
+	case v1.SecretList:
+		return *secretList(&v)
+	}
+	return v
+}
+
+// Values applies Value to every value, e.g. the arguments of a log line.
+func Values(values []interface{}) []interface{} {
+	masked := make([]interface{}, len(values))
+	for i, v := range values {
+		masked[i] = Value(v)
+	}
+	return masked
+}
+
+func secretList(list *v1.SecretList) *v1.SecretList {
+	masked := list.DeepCopy()
+	for i := range masked.Items {
+		masked.Items[i] = *Secret(&masked.Items[i])
+	}
+	return masked
+}
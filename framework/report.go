@@ -0,0 +1,80 @@
+package framework
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zryfish/framework/framework/junit"
+	"github.com/zryfish/framework/framework/redact"
+	"k8s.io/client-go/discovery"
+)
+
+// ReportProperties returns the metadata attached to the JUnit reports: the run id,
+// the server version of the cluster under test, the kube context, the flags set
+// on the command line, the effective config, the capabilities specs were skipped for
+// and the images nodes failed to pre-pull.
+func ReportProperties() []junit.Property {
+	properties := append([]junit.Property{
+		{Name: "RunId", Value: string(RunId)},
+		{Name: "ServerVersion", Value: serverVersion()},
+		{Name: "KubeContext", Value: currentKubeContext()},
+		{Name: "Flags", Value: redact.String(strings.Join(flagsUsed(), " "))},
+	}, configProperties()...)
+	properties = append(properties, skipProperties()...)
+	return append(properties, prePullProperties()...)
+}
+
+// serverVersion returns the git version of the apiserver, or "unknown" if it can't be reached.
+func serverVersion() string {
+	config, err := LoadConfig()
+	if err != nil {
+		Logf("Unable to load client config to get server version: %v", err)
+		return "unknown"
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		Logf("Unable to create discovery client to get server version: %v", err)
+		return "unknown"
+	}
+	version, err := client.ServerVersion()
+	if err != nil {
+		Logf("Unable to get server version: %v", err)
+		return "unknown"
+	}
+	return version.GitVersion
+}
+
+// currentKubeContext returns the context selected by flag, falling back to the kubeconfig current context.
+func currentKubeContext() string {
+	if TestContext.KubeContext != "" {
+		return TestContext.KubeContext
+	}
+	if TestContext.KubeConfig == "" {
+		return ""
+	}
+	c, err := RestclientConfig("")
+	if err != nil {
+		return ""
+	}
+	return c.CurrentContext
+}
+
+// flagsUsed returns the flags explicitly set on the command line, sorted by name.
+// The ginkgo.parallel flags differ on every node and are left out.
+func flagsUsed() []string {
+	var flags []string
+	flag.Visit(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "ginkgo.parallel.") {
+			return
+		}
+		// flags set from the config file or the environment are reported with the config
+		if source, ok := configSources[f.Name]; ok && source != sourceFlag {
+			return
+		}
+		flags = append(flags, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	sort.Strings(flags)
+	return flags
+}
@@ -0,0 +1,66 @@
+package framework
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/onsi/ginkgo/config"
+)
+
+var (
+	// serialFocus and serialSkip select the Serial specs held back from a parallel run.
+	serialFocus string
+	serialSkip  string
+)
+
+// serialExcludedFlags are the flags of the parallel run not passed on to the
+// run of the Serial specs.
+var serialExcludedFlags = []string{"ginkgo.parallel.", "ginkgo.syncHost", "ginkgo.streamHost", "ginkgo.focus", "ginkgo.skip", "labels", "report-prefix", "run-id", "serial-child"}
+
+// SerialReportPrefix returns the report prefix of the run of the Serial specs held back from a parallel run.
+func SerialReportPrefix() string {
+	return TestContext.ReportPrefix + "-serial"
+}
+
+// RunSerialSpecs runs the Serial specs held back from a parallel run, once all
+// the other specs have finished. It must be called on ginkgo node 1 after the
+// other nodes are done, e.g. in the node 1 function of SynchronizedAfterSuite.
+// The test binary is run again, on a single node, with the same flags and run
+// id, and writes its reports and timelines with SerialReportPrefix. It skips
+// the setup of the suite done by the parallel run, see
+// TestContext.SerialChild. It does nothing in serial runs.
+func RunSerialSpecs() error {
+	if config.GinkgoConfig.ParallelTotal <= 1 || config.GinkgoConfig.ParallelNode != 1 {
+		return nil
+	}
+	if suiteContext.Err() != nil {
+		Logf("Run interrupted, not running the Serial specs")
+		return nil
+	}
+
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, excluded := range serialExcludedFlags {
+			if strings.HasPrefix(f.Name, excluded) {
+				return
+			}
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+	})
+	args = append(args, "-ginkgo.focus="+serialFocus, "-report-prefix="+SerialReportPrefix(), "-run-id="+string(RunId), "-serial-child=true")
+	if serialSkip != "" {
+		args = append(args, "-ginkgo.skip="+serialSkip)
+	}
+
+	Logf("Running the Serial specs held back from the parallel run")
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("serial specs failed, see the %s report: %v", SerialReportPrefix(), err)
+	}
+	return nil
+}
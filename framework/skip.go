@@ -0,0 +1,288 @@
+package framework
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zryfish/framework/framework/ginkgowrapper"
+	"github.com/zryfish/framework/framework/junit"
+	e2elog "github.com/zryfish/framework/framework/log"
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// defaultStorageClassAnnotation marks the default storage class.
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// capabilityCheck is the cached result of a capability check, reason tells
+// what is missing when ok is false.
+type capabilityCheck struct {
+	ok     bool
+	reason string
+}
+
+var (
+	capabilitiesLock sync.Mutex
+	// capabilities caches the checks for the whole suite, by capability.
+	capabilities = map[string]capabilityCheck{}
+	// missingCapabilities are the reasons of the skips, reported in the suite properties.
+	missingCapabilities = map[string]bool{}
+)
+
+// Skipf skips the current spec with a formatted reason.
+func Skipf(format string, args ...interface{}) {
+	ginkgowrapper.Skip(fmt.Sprintf(format, args...), 1)
+}
+
+// skipUnless skips the current spec unless the capability is available. The
+// check runs once per suite, errors fail the spec and aren't cached.
+func skipUnless(capability string, check func() (bool, string, error)) {
+	capabilitiesLock.Lock()
+	result, ok := capabilities[capability]
+	capabilitiesLock.Unlock()
+
+	if !ok {
+		available, reason, err := check()
+		if err != nil {
+			e2elog.FailfWithOffset(2, "Failed to check %s: %v", capability, err)
+		}
+		result = capabilityCheck{ok: available, reason: reason}
+		capabilitiesLock.Lock()
+		capabilities[capability] = result
+		capabilitiesLock.Unlock()
+	}
+	if result.ok {
+		return
+	}
+
+	capabilitiesLock.Lock()
+	missingCapabilities[result.reason] = true
+	capabilitiesLock.Unlock()
+	ginkgowrapper.Skip(result.reason, 2)
+}
+
+// SkipUnlessCapability skips the current spec unless the provider has the capability.
+func SkipUnlessCapability(capability Capability) {
+	skipUnless("capability "+string(capability), func() (bool, string, error) {
+		return HasCapability(capability), fmt.Sprintf("provider %s lacks capability %s", Provider().Name(), capability), nil
+	})
+}
+
+// SkipUnlessResourceServed skips the current spec unless the apiserver serves the resource.
+func SkipUnlessResourceServed(c clientset.Interface, gvr schema.GroupVersionResource) {
+	skipUnless("resource "+gvr.String(), func() (bool, string, error) {
+		reason := fmt.Sprintf("resource %s is not served", gvr.String())
+		resources, err := c.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+		if apierrs.IsNotFound(err) {
+			return false, reason, nil
+		}
+		if err != nil {
+			return false, "", err
+		}
+		for _, r := range resources.APIResources {
+			if r.Name == gvr.Resource {
+				return true, "", nil
+			}
+		}
+		return false, reason, nil
+	})
+}
+
+// SkipUnlessServerVersionGTE skips the current spec unless the apiserver version is at least version, e.g. "v1.15.0".
+func SkipUnlessServerVersionGTE(c clientset.Interface, version string) {
+	minVersion := utilversion.MustParseSemantic(version)
+	skipUnless("server version >= "+version, func() (bool, string, error) {
+		info, err := c.Discovery().ServerVersion()
+		if err != nil {
+			return false, "", err
+		}
+		serverVersion, err := utilversion.ParseSemantic(info.GitVersion)
+		if err != nil {
+			return false, "", fmt.Errorf("error parsing server version %q: %v", info.GitVersion, err)
+		}
+		return serverVersion.AtLeast(minVersion), fmt.Sprintf("server version %s is older than %s", info.GitVersion, version), nil
+	})
+}
+
+// SkipUnlessSchedulableNodesAtLeast skips the current spec unless the cluster has at least n
+// ready nodes accepting pods.
+func SkipUnlessSchedulableNodesAtLeast(c clientset.Interface, n int) {
+	skipUnless(fmt.Sprintf("%d schedulable nodes", n), func() (bool, string, error) {
+		nodes, err := c.CoreV1().Nodes().List(metav1.ListOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		schedulable := 0
+		for i := range nodes.Items {
+			if isNodeSchedulable(&nodes.Items[i]) {
+				schedulable++
+			}
+		}
+		return schedulable >= n, fmt.Sprintf("cluster has %d schedulable nodes, %d needed", schedulable, n), nil
+	})
+}
+
+// isNodeSchedulable returns true if the node is ready and accepts new pods.
+func isNodeSchedulable(node *v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == v1.TaintEffectNoSchedule || taint.Effect == v1.TaintEffectNoExecute {
+			return false
+		}
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// SkipUnlessFeatureGateEnabled skips the current spec unless the feature gate is
+// explicitly enabled on the apiserver, gates enabled by default aren't detected.
+// Gates are read from the flags of the apiserver pods, so specs are skipped where
+// the control plane isn't visible, e.g. on managed clusters.
+func SkipUnlessFeatureGateEnabled(c clientset.Interface, gate string) {
+	skipUnless("feature gate "+gate, func() (bool, string, error) {
+		values, found, err := apiserverFlag(c, "feature-gates")
+		if err != nil {
+			return false, "", err
+		}
+		if !found {
+			return false, fmt.Sprintf("feature gate %s is not detectable, no apiserver pod sets --feature-gates", gate), nil
+		}
+		for _, value := range values {
+			for _, setting := range strings.Split(value, ",") {
+				if setting == gate+"=true" {
+					return true, "", nil
+				}
+			}
+		}
+		return false, fmt.Sprintf("feature gate %s is not enabled", gate), nil
+	})
+}
+
+// SkipUnlessAdmissionPluginEnabled skips the current spec unless the admission plugin
+// is explicitly enabled on the apiserver, read from the flags of the apiserver pods.
+func SkipUnlessAdmissionPluginEnabled(c clientset.Interface, plugin string) {
+	skipUnless("admission plugin "+plugin, func() (bool, string, error) {
+		values, found, err := apiserverFlag(c, "enable-admission-plugins")
+		if err != nil {
+			return false, "", err
+		}
+		if !found {
+			return false, fmt.Sprintf("admission plugin %s is not detectable, no apiserver pod sets --enable-admission-plugins", plugin), nil
+		}
+		for _, value := range values {
+			for _, p := range strings.Split(value, ",") {
+				if p == plugin {
+					return true, "", nil
+				}
+			}
+		}
+		return false, fmt.Sprintf("admission plugin %s is not enabled", plugin), nil
+	})
+}
+
+// apiserverFlag returns the values of a flag of the apiserver pods of kube-system,
+// as run by kubeadm and kind, and whether any pod sets it.
+func apiserverFlag(c clientset.Interface, name string) ([]string, bool, error) {
+	pods, err := c.CoreV1().Pods(metav1.NamespaceSystem).List(metav1.ListOptions{LabelSelector: "component=kube-apiserver"})
+	if err != nil {
+		return nil, false, err
+	}
+	prefix := "--" + name + "="
+	var values []string
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			for _, arg := range append(append([]string{}, container.Command...), container.Args...) {
+				if strings.HasPrefix(arg, prefix) {
+					values = append(values, strings.TrimPrefix(arg, prefix))
+				}
+			}
+		}
+	}
+	return values, len(values) > 0, nil
+}
+
+// SkipUnlessStorageClassExists skips the current spec unless the storage class
+// exists, or unless there is a default storage class when name is "".
+func SkipUnlessStorageClassExists(c clientset.Interface, name string) {
+	skipUnless("storage class "+name, func() (bool, string, error) {
+		if name != "" {
+			_, err := c.StorageV1().StorageClasses().Get(name, metav1.GetOptions{})
+			if apierrs.IsNotFound(err) {
+				return false, fmt.Sprintf("storage class %s does not exist", name), nil
+			}
+			return err == nil, "", err
+		}
+		classes, err := c.StorageV1().StorageClasses().List(metav1.ListOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		for _, class := range classes.Items {
+			if class.Annotations[defaultStorageClassAnnotation] == "true" {
+				return true, "", nil
+			}
+		}
+		return false, "cluster has no default storage class", nil
+	})
+}
+
+// ingressClassVersions are the versions of the IngressClass API, newest first.
+var ingressClassVersions = []string{"v1", "v1beta1"}
+
+// SkipUnlessIngressClassExists skips the current spec unless the ingress class exists.
+// IngressClass is newer than this client, it is read with the dynamic client.
+func SkipUnlessIngressClassExists(c clientset.Interface, d dynamic.Interface, name string) {
+	skipUnless("ingress class "+name, func() (bool, string, error) {
+		for _, version := range ingressClassVersions {
+			gvr := schema.GroupVersionResource{Group: "networking.k8s.io", Version: version, Resource: "ingressclasses"}
+			resources, err := c.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+			if apierrs.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, "", err
+			}
+			served := false
+			for _, r := range resources.APIResources {
+				served = served || r.Name == gvr.Resource
+			}
+			if !served {
+				continue
+			}
+			_, err = d.Resource(gvr).Get(name, metav1.GetOptions{})
+			if apierrs.IsNotFound(err) {
+				return false, fmt.Sprintf("ingress class %s does not exist", name), nil
+			}
+			return err == nil, "", err
+		}
+		return false, "IngressClass API is not served", nil
+	})
+}
+
+// skipProperties returns the reasons of the skips of the suite as report properties.
+func skipProperties() []junit.Property {
+	capabilitiesLock.Lock()
+	defer capabilitiesLock.Unlock()
+	var reasons []string
+	for reason := range missingCapabilities {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	var properties []junit.Property
+	for _, reason := range reasons {
+		properties = append(properties, junit.Property{Name: "MissingCapability", Value: reason})
+	}
+	return properties
+}
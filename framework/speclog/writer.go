@@ -0,0 +1,140 @@
+package speclog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+	"github.com/zryfish/framework/framework/ginkgowrapper"
+	"github.com/zryfish/framework/framework/redact"
+)
+
+// FileFunc returns the log file of a spec run on a ginkgo node, "" to not write it.
+type FileFunc func(spec string, node int) string
+
+// Writer is a ginkgo reporter writing the GinkgoWriter output of every spec
+// into its own file, redacted. Retries of a spec are appended to the file of
+// the first attempt.
+type Writer struct {
+	file FileFunc
+
+	lock     sync.Mutex
+	out      *os.File
+	partial  []byte
+	attempts map[string]int
+}
+
+// NewWriter creates a writer of the files returned by file and hooks it to GinkgoWriter.
+func NewWriter(file FileFunc) *Writer {
+	w := &Writer{
+		file:     file,
+		attempts: map[string]int{},
+	}
+	ginkgowrapper.TeeGinkgoWriter(w)
+	return w
+}
+
+// Write writes the complete lines written to GinkgoWriter while a spec runs.
+func (w *Writer) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.out == nil {
+		return len(b), nil
+	}
+	w.partial = append(w.partial, b...)
+	if i := bytes.LastIndexByte(w.partial, '\n'); i >= 0 {
+		w.writeString(string(w.partial[:i+1]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *Writer) writeString(s string) {
+	if w.out == nil {
+		return
+	}
+	if _, err := w.out.WriteString(redact.String(s)); err != nil {
+		fmt.Printf("Failed to write spec log %s: %v\n", w.out.Name(), err)
+		w.out.Close()
+		w.out = nil
+	}
+}
+
+func (w *Writer) SpecSuiteWillBegin(config config.GinkgoConfigType, summary *types.SuiteSummary) {}
+
+func (w *Writer) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+func (w *Writer) SpecWillRun(specSummary *types.SpecSummary) {
+	if specSummary.State == types.SpecStateSkipped || specSummary.State == types.SpecStatePending {
+		return
+	}
+	name := strings.Join(specSummary.ComponentTexts[1:], " ")
+	filename := w.file(name, config.GinkgoConfig.ParallelNode)
+	if filename == "" {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.attempts[name]++
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if w.attempts[name] == 1 {
+		flags |= os.O_TRUNC
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		fmt.Printf("Failed to create spec log directory: %v\n", err)
+		return
+	}
+	out, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		fmt.Printf("Failed to create spec log %s: %v\n", filename, err)
+		return
+	}
+	w.out = out
+	w.partial = nil
+	w.writeString(fmt.Sprintf("=== %s (attempt %d) started %s\n", name, w.attempts[name], time.Now().Format(time.RFC3339)))
+}
+
+func (w *Writer) SpecDidComplete(specSummary *types.SpecSummary) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.out == nil {
+		return
+	}
+	if len(w.partial) > 0 {
+		w.writeString(string(w.partial) + "\n")
+	}
+	result := "passed"
+	if specSummary.HasFailureState() {
+		result = fmt.Sprintf("failed: %s\n%s", specSummary.Failure.Message, specSummary.Failure.Location.String())
+	}
+	w.writeString(fmt.Sprintf("=== %s after %v\n", result, specSummary.RunTime))
+	w.close()
+}
+
+func (w *Writer) close() {
+	if w.out == nil {
+		return
+	}
+	if err := w.out.Close(); err != nil {
+		fmt.Printf("Failed to write spec log %s: %v\n", w.out.Name(), err)
+	}
+	w.out = nil
+	w.partial = nil
+}
+
+func (w *Writer) AfterSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+func (w *Writer) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.close()
+}
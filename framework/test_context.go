@@ -3,6 +3,9 @@ package framework
 import (
 	"flag"
     "fmt"
+
+    e2elog "github.com/zryfish/framework/framework/log"
+    "k8s.io/apimachinery/pkg/types"
     "k8s.io/client-go/tools/clientcmd"
 )
 
@@ -21,18 +24,149 @@ type TestContextType struct {
 	CertDir            string
 	Host               string
 
-	ReportDir string
+	// Provider is the name of the provider of the environment under test, see Provider().
+	Provider string
+
+	ReportDir    string
+	ReportPrefix string
 
 	DeleteNamespace          bool
 	DeleteNamespaceOnFailure bool
+
+	// SpecRetries is how many times a failed spec is re-run, a spec passing on retry is reported as flaky.
+	SpecRetries int
+
+	// QuarantineFile is the YAML file listing the quarantined specs, loaded into Quarantine.
+	QuarantineFile string
+	Quarantine     *Quarantine
+
+	// LogLevel and LogFormat configure the framework log package.
+	LogLevel  string
+	LogFormat string
+
+	// ClientLogVerbosity is the klog verbosity of client-go, whose output goes to the spec output.
+	ClientLogVerbosity int
+
+	// TimeoutProfile names the timeouts of the environment, TimeoutMultiplier scales them, see Timeouts.
+	TimeoutProfile    string
+	TimeoutMultiplier float64
+
+	// LabelFilter is a boolean expression of spec labels selecting the specs to run, see Label.
+	LabelFilter string
+
+	// PrePullImages pulls the images of the image registry onto the nodes before the suite, see PrePullImages.
+	PrePullImages bool
+
+	// StorageClass is the storage class of the claims of the specs, see StorageClass.
+	StorageClass string
+
+	// RunId sets the run id, see RunId, e.g. to the run id of the parallel run
+	// on the run of the Serial specs it holds back.
+	RunId string
+
+	// SerialChild marks the run of the Serial specs held back from a parallel
+	// run, see RunSerialSpecs. The suite set up by the parallel run isn't set up again.
+	SerialChild bool
+
+	// SpecLogFiles writes the output of every spec into its own file under ReportDir/logs.
+	SpecLogFiles bool
 }
 
 var TestContext TestContextType
 
+// RegisterFlags registers the flags of the framework. Flags not given on the
+// command line are read from the E2E_<FLAG> environment variables, then from
+// the YAML config file given by --e2e-config or E2E_CONFIG, whose keys are the
+// flag names.
 func RegisterFlags() {
+	registered := map[string]bool{}
+	flag.VisitAll(func(f *flag.Flag) {
+		registered[f.Name] = true
+	})
+	defer flag.VisitAll(func(f *flag.Flag) {
+		if !registered[f.Name] && f.Name != configFileFlag {
+			configFlags = append(configFlags, f.Name)
+		}
+	})
+
+	RegisterConfigSection("timeouts", &timeoutConfig)
+	RegisterConfigSection("images", &imageConfig)
+	RegisterConfigSection("pods", &podConfig)
+	flag.StringVar(&configFile, configFileFlag, "", "Path to a YAML file setting the flags not given on the command line, keyed by flag name, and the custom sections of the suite. Defaults to $"+configFileEnv+".")
 	flag.StringVar(&TestContext.KubeConfig, clientcmd.RecommendedConfigPathFlag, clientcmd.RecommendedHomeFile, "Path to kubeconfig containing embedded authinfo.")
+	flag.StringVar(&TestContext.KubeContext, clientcmd.FlagContext, "", "kubeconfig context to use/override. If unset, will use value from 'current-context'.")
+	flag.StringVar(&TestContext.KubeAPIContentType, "kube-api-content-type", "", "ContentType used to communicate with apiserver, application/json or application/vnd.kubernetes.protobuf. Defaults to the client default.")
+	flag.StringVar(&TestContext.KubeVolumeDir, "volume-dir", "/var/lib/kubelet", "Path to the directory containing the kubelet volumes.")
+	flag.StringVar(&TestContext.CertDir, "cert-dir", "", "Path to the directory containing the certs. Default is empty, which doesn't use certs.")
+	flag.StringVar(&TestContext.Provider, "provider", "local", "The name of the provider of the environment under test: local (kubeconfig only) or localcluster (nodes are local containers, as with kind).")
 	flag.StringVar(&TestContext.ReportDir, "report-dir", "", "Path to the directory where the JUnit XML reports should be saved. Default is empty, which doesn't generate these reports.")
+	flag.StringVar(&TestContext.ReportPrefix, "report-prefix", "service", "Prefix for the JUnit XML report file names, each ginkgo node writes <prefix>_<node>.xml and they are merged into <prefix>.xml.")
 	flag.StringVar(&TestContext.Host, "host", "", fmt.Sprintf("The host, or apiserver, to connect to. Will default to %s if this argument and --kubeconfig are not set", defaultHost))
 	flag.BoolVar(&TestContext.DeleteNamespace, "delete-namespace", true, "If true tests will delete namespace after completion. It is only designed to make debugging easier, DO NOT turn it off by default.")
 	flag.BoolVar(&TestContext.DeleteNamespaceOnFailure, "delete-namespace-on-failure", false, "If true, framework will delete test namespace on failure. Used only during test debugging.")
+	flag.StringVar(&TestContext.QuarantineFile, "quarantine-file", "", "Path to a YAML file listing quarantined specs. Quarantined specs run, but their failures don't fail the suite.")
+	flag.StringVar(&TestContext.LogLevel, "log-level", "info", "Minimum level of the framework log lines: debug, info, warn or error.")
+	flag.StringVar(&TestContext.LogFormat, "log-format", e2elog.FormatText, "Format of the framework log lines: text or json.")
+	flag.IntVar(&TestContext.ClientLogVerbosity, "client-log-verbosity", 0, "Verbosity of the client-go logs written to the spec output, requests are logged from 6 on.")
+	flag.StringVar(&TestContext.TimeoutProfile, "timeout-profile", "default", "Timeouts of the environment under test: default, fast (local cluster) or slow (shared cloud cluster). Single timeouts can be set in the timeouts section of the config file.")
+	flag.Float64Var(&TestContext.TimeoutMultiplier, "timeout-multiplier", 1, "Factor applied to every timeout of the profile, e.g. 2 on an overloaded cluster.")
+	flag.StringVar(&TestContext.LabelFilter, "labels", "", "Boolean expression of spec labels selecting the specs to run, e.g. \"Feature:CSI && !(Slow || Disruptive)\". Translated to ginkgo focus and skip regexes.")
+	flag.BoolVar(&TestContext.PrePullImages, "prepull-images", true, "If true, the test images are pulled onto the schedulable nodes before the suite, so the first specs don't wait for image pulls.")
+	flag.StringVar(&TestContext.StorageClass, "storage-class", "", "Storage class of the claims created by the framework, or "+HostPathStorageClass+" for hostPath volumes created by the framework on clusters without a provisioner. Defaults to the storage class of the provider, then to the cluster default.")
+	flag.BoolVar(&TestContext.SpecLogFiles, "spec-log-files", false, "If true, the output of every spec is written, redacted, to its own file in the logs directory of the report directory.")
+	flag.StringVar(&TestContext.RunId, "run-id", "", "Run id labelling the namespaces and reports of the run. Defaults to a new id, it is set on the run of the Serial specs held back from a parallel run.")
+	flag.BoolVar(&TestContext.SerialChild, "serial-child", false, "Set on the run of the Serial specs held back from a parallel run, which skips the provider setup and teardown and the image pre-pull already done by the parallel run.")
+	flag.IntVar(&TestContext.SpecRetries, "spec-retries", 0, "Number of times a failed spec is re-run in a fresh namespace. Specs passing on retry are reported as flaky.")
+}
+
+// AfterReadingAllFlags applies the config file and the environment, validates
+// the settings, applies the log settings and loads the files referenced by the
+// flags. It must be called once flags are parsed.
+func AfterReadingAllFlags(t *TestContextType) error {
+	if err := applyConfig(); err != nil {
+		return err
+	}
+	if err := t.validate(); err != nil {
+		return err
+	}
+	resolved, err := resolveTimeouts(t.TimeoutProfile, t.TimeoutMultiplier, timeoutConfig)
+	if err != nil {
+		return err
+	}
+	timeouts = resolved
+	if t.RunId != "" {
+		RunId = types.UID(t.RunId)
+	}
+	if err := applyImageConfig(imageConfig); err != nil {
+		return err
+	}
+	handleInterrupts()
+	if err := setupProvider(t.Provider); err != nil {
+		return err
+	}
+	if err := applyLabelFilter(t.LabelFilter); err != nil {
+		return err
+	}
+
+	level, err := e2elog.ParseLevel(t.LogLevel)
+	if err != nil {
+		return err
+	}
+	e2elog.SetLevel(level)
+	if err := e2elog.SetFormat(t.LogFormat); err != nil {
+		return err
+	}
+	if err := e2elog.RedirectKlog(t.ClientLogVerbosity); err != nil {
+		return err
+	}
+
+	if t.QuarantineFile != "" {
+		q, err := LoadQuarantine(t.QuarantineFile)
+		if err != nil {
+			return err
+		}
+		q.WarnExpired()
+		t.Quarantine = q
+	}
+	return nil
 }
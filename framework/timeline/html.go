@@ -0,0 +1,128 @@
+package timeline
+
+import (
+	"html/template"
+	"os"
+	"time"
+)
+
+// segment is a step drawn on the timeline bar of a spec.
+type segment struct {
+	Text     string
+	Offset   float64
+	Width    float64
+	Duration time.Duration
+}
+
+// specView is a spec prepared for the template.
+type specView struct {
+	*Spec
+	Duration time.Duration
+	Segments []segment
+}
+
+// Offset returns the time of an event relative to the start of the spec.
+func (v specView) Offset(e Event) string {
+	return e.Time.Sub(v.Start).Truncate(time.Millisecond).String()
+}
+
+func (v specView) Failed() bool {
+	return v.State == "failed" || v.State == "panicked" || v.State == "timedout"
+}
+
+func newSpecView(spec *Spec) specView {
+	v := specView{Spec: spec, Duration: spec.End.Sub(spec.Start).Truncate(time.Millisecond)}
+	total := spec.End.Sub(spec.Start)
+	if total <= 0 {
+		return v
+	}
+
+	var steps []Event
+	for _, e := range spec.Events {
+		if e.Step {
+			steps = append(steps, e)
+		}
+	}
+	for i, step := range steps {
+		end := spec.End
+		if i+1 < len(steps) {
+			end = steps[i+1].Time
+		}
+		v.Segments = append(v.Segments, segment{
+			Text:     step.Text,
+			Offset:   100 * float64(step.Time.Sub(spec.Start)) / float64(total),
+			Width:    100 * float64(end.Sub(step.Time)) / float64(total),
+			Duration: end.Sub(step.Time).Truncate(time.Millisecond),
+		})
+	}
+	return v
+}
+
+// WriteHTML renders the timelines of specs into a self-contained HTML report.
+func WriteHTML(filename, title string, specs []*Spec) error {
+	data := struct {
+		Title     string
+		Generated string
+		Specs     []specView
+		Counts    map[string]int
+	}{
+		Title:     title,
+		Generated: time.Now().Format(time.RFC1123),
+		Counts:    map[string]int{},
+	}
+	for _, spec := range specs {
+		data.Specs = append(data.Specs, newSpecView(spec))
+		data.Counts[spec.State]++
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+summary { cursor: pointer; }
+.spec { border: 1px solid #ddd; border-radius: 4px; margin: .5em 0; padding: .4em .8em; }
+.state { display: inline-block; min-width: 5em; font-weight: bold; }
+.passed { color: #2a7d2a; } .failed, .panicked, .timedout { color: #c62828; } .skipped, .pending { color: #888; }
+.meta { color: #666; font-size: .9em; }
+.bar { position: relative; height: 1.4em; background: #f3f3f3; margin: .6em 0; }
+.seg { position: absolute; top: 0; height: 100%; background: #90caf9; border-right: 1px solid #fff; overflow: hidden; white-space: nowrap; font-size: .75em; line-height: 1.9em; box-sizing: border-box; padding-left: 2px; }
+.seg:nth-child(even) { background: #64b5f6; }
+pre { background: #fafafa; border: 1px solid #eee; padding: .5em; overflow-x: auto; }
+table.log { border-collapse: collapse; font-family: monospace; font-size: .85em; }
+table.log td { padding: 0 .6em; vertical-align: top; white-space: pre-wrap; }
+tr.step td { font-weight: bold; background: #e3f2fd; }
+tr.WARNING td, tr.WARN td { background: #fff8e1; } tr.ERROR td, tr.FAIL td { background: #ffebee; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.Generated}} &mdash; {{range $state, $count := .Counts}}<span class="{{$state}}">{{$count}} {{$state}}</span> {{end}}</p>
+{{range .Specs}}
+<details class="spec"{{if .Failed}} open{{end}}>
+<summary><span class="state {{.State}}">{{.State}}</span> {{.Name}} <span class="meta">{{.Duration}}, node {{.Node}}{{if gt .Attempt 1}}, attempt {{.Attempt}}{{end}}</span></summary>
+{{if .Segments}}<div class="bar">{{range .Segments}}<div class="seg" style="left: {{printf "%.3f" .Offset}}%; width: {{printf "%.3f" .Width}}%" title="{{.Text}} ({{.Duration}})">{{.Text}}</div>{{end}}</div>{{end}}
+{{if .Failure}}<h4>Failure</h4><pre>{{.Failure}}
+{{.Location}}</pre>{{if .Stack}}<details><summary>Stack</summary><pre>{{.Stack}}</pre></details>{{end}}{{end}}
+{{if .Events}}<details><summary>Log ({{len .Events}} lines)</summary>
+<table class="log">{{$spec := .}}{{range .Events}}<tr class="{{if .Step}}step{{else}}{{.Level}}{{end}}"><td>+{{$spec.Offset .}}</td><td>{{if .Step}}STEP{{else}}{{.Level}}{{end}}</td><td>{{.Text}}</td></tr>{{end}}</table>
+</details>{{end}}
+{{if .Artifacts}}<h4>Artifacts</h4><ul>{{range .Artifacts}}<li><a href="{{.}}">{{.}}</a></li>{{end}}</ul>{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`))
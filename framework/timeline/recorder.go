@@ -0,0 +1,341 @@
+package timeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+	"github.com/zryfish/framework/framework/ginkgowrapper"
+	"github.com/zryfish/framework/framework/junit"
+	"github.com/zryfish/framework/framework/redact"
+)
+
+// Event is a step or a log line of a spec.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Step  bool      `json:"step,omitempty"`
+	Level string    `json:"level,omitempty"`
+	Text  string    `json:"text"`
+}
+
+// Spec is the timeline of one attempt of a spec.
+type Spec struct {
+	Name      string    `json:"name"`
+	Node      int       `json:"node"`
+	Attempt   int       `json:"attempt"`
+	State     string    `json:"state"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Events    []Event   `json:"events,omitempty"`
+	Failure   string    `json:"failure,omitempty"`
+	Location  string    `json:"location,omitempty"`
+	Stack     string    `json:"stack,omitempty"`
+	Artifacts []string  `json:"artifacts,omitempty"`
+}
+
+// ArtifactsFunc returns the directory holding the artifacts of an attempt of a spec.
+type ArtifactsFunc func(spec string, attempt int) string
+
+var (
+	// ansiEscape matches the color codes ginkgo adds to its output.
+	ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	// logLine matches the text lines written by the framework log package, "Jan _2 15:04:05.000: LEVEL: message".
+	logLine = regexp.MustCompile(`^\w{3} [ \d]\d \d{2}:\d{2}:\d{2}\.\d{3}: ([A-Z]+): (.*)$`)
+)
+
+const stepPrefix = "STEP: "
+
+// Recorder is a ginkgo reporter recording the steps and log lines of every spec
+// from GinkgoWriter. Every node writes its timelines to the report directory and
+// node 1 renders the timelines of all nodes into a single HTML report.
+type Recorder struct {
+	dir       string
+	prefix    string
+	artifacts ArtifactsFunc
+	timeout   time.Duration
+
+	lock     sync.Mutex
+	started  time.Time
+	current  *Spec
+	partial  []byte
+	specs    []*Spec
+	attempts map[string]int
+	included []string
+}
+
+// NewRecorder creates a recorder writing to dir and hooks it to GinkgoWriter.
+// artifacts may be nil if specs have no artifacts.
+func NewRecorder(dir, prefix string, artifacts ArtifactsFunc, timeout time.Duration) *Recorder {
+	r := &Recorder{
+		dir:       dir,
+		prefix:    prefix,
+		artifacts: artifacts,
+		timeout:   timeout,
+		attempts:  map[string]int{},
+	}
+	ginkgowrapper.TeeGinkgoWriter(r)
+	ginkgowrapper.OnFailure(r.recordFailure)
+	return r
+}
+
+// Include adds timelines to the HTML report, e.g. written by another run of
+// the suite. They are included if they were written during the run, and
+// ignored otherwise.
+func (r *Recorder) Include(files ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.included = append(r.included, files...)
+}
+
+// NodeTimelineFile returns the path of the timelines recorded by a ginkgo node.
+func NodeTimelineFile(dir, prefix string, node int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_timeline_%02d.json", prefix, node))
+}
+
+// HTMLReportFile returns the path of the HTML report.
+func HTMLReportFile(dir, prefix string) string {
+	return filepath.Join(dir, prefix+".html")
+}
+
+// Write records the complete lines written to GinkgoWriter while a spec runs.
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.current == nil {
+		return len(b), nil
+	}
+	now := time.Now()
+	r.partial = append(r.partial, b...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		r.recordLine(now, string(r.partial[:i]))
+		r.partial = r.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+func (r *Recorder) recordLine(now time.Time, line string) {
+	line = redact.String(strings.TrimRight(ansiEscape.ReplaceAllString(line, ""), " \r"))
+	if line == "" {
+		return
+	}
+	if strings.HasPrefix(line, stepPrefix) {
+		r.current.Events = append(r.current.Events, Event{Time: now, Step: true, Text: strings.TrimPrefix(line, stepPrefix)})
+		return
+	}
+	if m := logLine.FindStringSubmatch(line); m != nil {
+		r.current.Events = append(r.current.Events, Event{Time: now, Level: m[1], Text: m[2]})
+		return
+	}
+	if e, ok := jsonLogLine(line); ok {
+		e.Time = now
+		r.current.Events = append(r.current.Events, e)
+		return
+	}
+	r.current.Events = append(r.current.Events, Event{Time: now, Text: line})
+}
+
+// jsonLogLine parses the lines written by the framework log package in JSON format.
+func jsonLogLine(line string) (Event, bool) {
+	if !strings.HasPrefix(line, "{") {
+		return Event{}, false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return Event{}, false
+	}
+	level, _ := fields["level"].(string)
+	msg, _ := fields["msg"].(string)
+	if level == "" {
+		return Event{}, false
+	}
+	delete(fields, "time")
+	delete(fields, "level")
+	delete(fields, "msg")
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		msg += fmt.Sprintf(" %s=%v", k, fields[k])
+	}
+	return Event{Level: level, Text: msg}, true
+}
+
+// recordFailure keeps the stack of the first failure of the running spec, as pruned by ginkgowrapper.
+func (r *Recorder) recordFailure(fp ginkgowrapper.FailurePanic) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.current != nil && r.current.Stack == "" {
+		r.current.Stack = fp.FullStackTrace
+	}
+}
+
+func (r *Recorder) SpecSuiteWillBegin(config config.GinkgoConfigType, summary *types.SuiteSummary) {
+	// file modification times may be coarser than the wall clock
+	r.started = time.Now().Truncate(time.Second)
+}
+
+func (r *Recorder) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+func (r *Recorder) SpecWillRun(specSummary *types.SpecSummary) {
+	if specSummary.State == types.SpecStateSkipped || specSummary.State == types.SpecStatePending {
+		return
+	}
+	name := strings.Join(specSummary.ComponentTexts[1:], " ")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.attempts[name]++
+	r.current = &Spec{
+		Name:    name,
+		Node:    config.GinkgoConfig.ParallelNode,
+		Attempt: r.attempts[name],
+		Start:   time.Now(),
+	}
+	r.partial = nil
+}
+
+func (r *Recorder) SpecDidComplete(specSummary *types.SpecSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	spec := r.current
+	if spec == nil {
+		return
+	}
+	r.current = nil
+
+	spec.End = time.Now()
+	spec.State = stateName(specSummary.State)
+	if specSummary.HasFailureState() {
+		spec.Failure = redact.String(specSummary.Failure.Message)
+		spec.Location = specSummary.Failure.Location.String()
+		if spec.Stack == "" {
+			// not failed through ginkgowrapper.Fail, e.g. a panic
+			spec.Stack = specSummary.Failure.Location.FullStackTrace
+		}
+	}
+	if r.artifacts != nil {
+		spec.Artifacts = r.listArtifacts(r.artifacts(spec.Name, spec.Attempt))
+	}
+	r.specs = append(r.specs, spec)
+}
+
+// listArtifacts returns the files in dir, relative to the report directory.
+func (r *Recorder) listArtifacts(dir string) []string {
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(r.dir, path); err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files
+}
+
+func (r *Recorder) AfterSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+func (r *Recorder) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	node := NodeTimelineFile(r.dir, r.prefix, config.GinkgoConfig.ParallelNode)
+	if err := writeSpecs(node, r.specs); err != nil {
+		fmt.Printf("Failed to write spec timelines %s: %v\n", node, err)
+		return
+	}
+	if config.GinkgoConfig.ParallelNode != 1 {
+		return
+	}
+
+	var files []string
+	for n := 1; n <= junit.ParallelNodes(); n++ {
+		files = append(files, NodeTimelineFile(r.dir, r.prefix, n))
+	}
+	if err := junit.WaitForFiles(files, r.started, r.timeout); err != nil {
+		fmt.Printf("Failed to generate HTML report: %v\n", err)
+		return
+	}
+	for _, file := range r.included {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Before(r.started) {
+			files = append(files, file)
+		}
+	}
+	var specs []*Spec
+	for _, file := range files {
+		nodeSpecs, err := readSpecs(file)
+		if err != nil {
+			fmt.Printf("Failed to generate HTML report: %v\n", err)
+			return
+		}
+		specs = append(specs, nodeSpecs...)
+	}
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].Start.Before(specs[j].Start) })
+
+	output := HTMLReportFile(r.dir, r.prefix)
+	if err := WriteHTML(output, summary.SuiteDescription, specs); err != nil {
+		fmt.Printf("Failed to generate HTML report %s: %v\n", output, err)
+	}
+}
+
+func writeSpecs(filename string, specs []*Spec) error {
+	data, err := json.Marshal(specs)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func readSpecs(filename string) ([]*Spec, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var specs []*Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	return specs, nil
+}
+
+func stateName(state types.SpecState) string {
+	switch state {
+	case types.SpecStatePassed:
+		return "passed"
+	case types.SpecStateFailed:
+		return "failed"
+	case types.SpecStatePanicked:
+		return "panicked"
+	case types.SpecStateTimedOut:
+		return "timedout"
+	case types.SpecStateSkipped:
+		return "skipped"
+	case types.SpecStatePending:
+		return "pending"
+	default:
+		return "invalid"
+	}
+}
@@ -0,0 +1,145 @@
+package framework
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timeouts are the durations the framework waits for, they come from the
+// timeout profile and are scaled by the timeout multiplier.
+type Timeouts struct {
+	// Poll is how often conditions are checked, it isn't scaled.
+	Poll time.Duration
+	// NamespaceCreate is how long creating a namespace is retried.
+	NamespaceCreate time.Duration
+	// NamespaceDelete is how long to wait for a namespace to be deleted.
+	NamespaceDelete time.Duration
+	// ServiceAccountProvision is how long to wait for the token of a service account.
+	ServiceAccountProvision time.Duration
+	// RBACPropagation is how long to wait for the authorizer to use new roles and bindings.
+	RBACPropagation time.Duration
+	// ServerResources is how long discovery of the server resources is retried.
+	ServerResources time.Duration
+	// PodStart is how long to wait for a pod to be running.
+	PodStart time.Duration
+	// ImagePrePull is how long to wait for the images to be pulled onto the nodes before the suite.
+	ImagePrePull time.Duration
+	// ClaimBound is how long to wait for a persistent volume claim to be bound.
+	ClaimBound time.Duration
+	// Spec is how long a spec may run before its context is canceled, 0 for no limit.
+	Spec time.Duration
+}
+
+// timeoutProfiles are the timeouts of the environments the suite runs on.
+var timeoutProfiles = map[string]Timeouts{
+	"default": {
+		Poll:                    Poll,
+		NamespaceCreate:         30 * time.Second,
+		NamespaceDelete:         DefaultNamespaceDeletionTimeout,
+		ServiceAccountProvision: ServiceAccountProvisionTimeout,
+		RBACPropagation:         time.Minute,
+		ServerResources:         30 * time.Second,
+		PodStart:                5 * time.Minute,
+		ImagePrePull:            10 * time.Minute,
+		ClaimBound:              5 * time.Minute,
+		Spec:                    30 * time.Minute,
+	},
+	// a local cluster, failures should show up quickly
+	"fast": {
+		Poll:                    500 * time.Millisecond,
+		NamespaceCreate:         15 * time.Second,
+		NamespaceDelete:         2 * time.Minute,
+		ServiceAccountProvision: 30 * time.Second,
+		RBACPropagation:         30 * time.Second,
+		ServerResources:         15 * time.Second,
+		PodStart:                2 * time.Minute,
+		ImagePrePull:            5 * time.Minute,
+		ClaimBound:              2 * time.Minute,
+		Spec:                    10 * time.Minute,
+	},
+	// a shared and loaded cloud cluster
+	"slow": {
+		Poll:                    5 * time.Second,
+		NamespaceCreate:         2 * time.Minute,
+		NamespaceDelete:         15 * time.Minute,
+		ServiceAccountProvision: 5 * time.Minute,
+		RBACPropagation:         5 * time.Minute,
+		ServerResources:         2 * time.Minute,
+		PodStart:                15 * time.Minute,
+		ImagePrePull:            30 * time.Minute,
+		ClaimBound:              15 * time.Minute,
+		Spec:                    time.Hour,
+	},
+}
+
+// timeoutOverrides is the "timeouts" section of the config file, overriding
+// timeouts of the profile before they are scaled, e.g. "namespaceDelete: 10m".
+type timeoutOverrides map[string]string
+
+var (
+	// timeoutConfig is decoded from the config file.
+	timeoutConfig = timeoutOverrides{}
+	// timeouts are the timeouts of the run, set once the flags are read.
+	timeouts = timeoutProfiles["default"]
+)
+
+// TimeoutProfiles returns the names of the timeout profiles, sorted.
+func TimeoutProfiles() []string {
+	var names []string
+	for name := range timeoutProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewTimeouts returns the timeouts of the run.
+func NewTimeouts() *Timeouts {
+	t := timeouts
+	return &t
+}
+
+// resolveTimeouts returns the timeouts of a profile with the overrides of the
+// config file, scaled by multiplier.
+func resolveTimeouts(profile string, multiplier float64, overrides timeoutOverrides) (Timeouts, error) {
+	t, ok := timeoutProfiles[profile]
+	if !ok {
+		return t, fmt.Errorf("unknown timeout profile %q, expected one of %s", profile, strings.Join(TimeoutProfiles(), ", "))
+	}
+	if multiplier <= 0 {
+		return t, fmt.Errorf("timeout-multiplier must be positive, got %v", multiplier)
+	}
+
+	fields := map[string]*time.Duration{
+		"poll":                    &t.Poll,
+		"namespaceCreate":         &t.NamespaceCreate,
+		"namespaceDelete":         &t.NamespaceDelete,
+		"serviceAccountProvision": &t.ServiceAccountProvision,
+		"rbacPropagation":         &t.RBACPropagation,
+		"serverResources":         &t.ServerResources,
+		"podStart":                &t.PodStart,
+		"imagePrePull":            &t.ImagePrePull,
+		"claimBound":              &t.ClaimBound,
+		"spec":                    &t.Spec,
+	}
+	for name, value := range overrides {
+		field, ok := fields[name]
+		if !ok {
+			return t, fmt.Errorf("unknown timeout %q in the timeouts config section", name)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return t, fmt.Errorf("invalid timeout %s in the timeouts config section: %v", name, err)
+		}
+		*field = d
+	}
+
+	for name, field := range fields {
+		if name != "poll" {
+			*field = time.Duration(float64(*field) * multiplier)
+		}
+	}
+	return t, nil
+}
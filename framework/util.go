@@ -1,17 +1,18 @@
 package framework
 
 import (
-	. "github.com/onsi/ginkgo"
-
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/golang/glog"
+	e2elog "github.com/zryfish/framework/framework/log"
+	"github.com/zryfish/framework/framework/redact"
+	"hash/crc32"
+	"io/ioutil"
 	v1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/uuid"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
@@ -19,10 +20,18 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/client-go/transport"
 	"k8s.io/kubernetes/pkg/client/conditions"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
+// Timeouts of the default profile, the framework waits use the Timeouts of the
+// run, see NewTimeouts.
 const (
 
 	// How often to Poll pods, nodes and claims.
@@ -36,8 +45,21 @@ const (
 	DefaultNamespaceDeletionTimeout = 5 * time.Minute
 )
 
-// LoadConfig returns a config for a rest client.
+// LoadConfig returns a config for a rest client, from the kubeconfig, or the
+// in-cluster config when no kubeconfig is given.
 func LoadConfig() (*restclient.Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if TestContext.KubeAPIContentType != "" {
+		config.ContentType = TestContext.KubeAPIContentType
+	}
+	registerCredentials(config)
+	return config, nil
+}
+
+func loadConfig() (*restclient.Config, error) {
 	c, err := RestclientConfig(TestContext.KubeContext)
 	if err != nil {
 		if TestContext.KubeConfig == "" {
@@ -45,10 +67,42 @@ func LoadConfig() (*restclient.Config, error) {
 		}
 		return nil, err
 	}
-
 	return clientcmd.NewDefaultClientConfig(*c, &clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: TestContext.Host}}).ClientConfig()
 }
 
+// registerCredentials keeps the credentials of config out of logs, artifacts
+// and reports. The tokens read from a file, or got from an exec or auth
+// provider plugin, are registered when the clients send them.
+func registerCredentials(config *restclient.Config) {
+	redact.Register(config.BearerToken, config.Password, string(config.KeyData))
+	if config.BearerTokenFile != "" {
+		if token, err := ioutil.ReadFile(config.BearerTokenFile); err == nil {
+			redact.Register(strings.TrimSpace(string(token)))
+		}
+	}
+	// the wrapped round tripper is the innermost, it gets the requests with
+	// the Authorization header set
+	config.WrapTransport = transport.Wrappers(config.WrapTransport, func(rt http.RoundTripper) http.RoundTripper {
+		return &credentialsRoundTripper{rt: rt}
+	})
+}
+
+// credentialsRoundTripper registers the credentials of the requests with redact.
+type credentialsRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (t *credentialsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		// "Bearer <token>" registers the token
+		if i := strings.Index(auth, " "); i != -1 {
+			auth = strings.TrimSpace(auth[i+1:])
+		}
+		redact.Register(auth)
+	}
+	return t.rt.RoundTrip(req)
+}
+
 func RestclientConfig(kubeContext string) (*clientcmdapi.Config, error) {
 	Logf(">>> kubeConfig: %s", TestContext.KubeConfig)
 	if TestContext.KubeConfig == "" {
@@ -70,12 +124,25 @@ func RestclientConfig(kubeContext string) (*clientcmdapi.Config, error) {
 
 var RunId = uuid.NewUUID()
 
+const (
+	// RunLabel is the label of the namespaces and objects of a run, its value is RunId.
+	RunLabel = "e2e-run"
+	// FrameworkLabel is the label of the namespaces and objects of a framework, its value is the base name.
+	FrameworkLabel = "e2e-framework"
+)
+
+// CreateTestingNS creates a namespace for a test, labelled with the run id, and
+// waits for its default service account.
 func CreateTestingNS(baseName string, c clientset.Interface, labels map[string]string) (*v1.Namespace, error) {
+	return createTestingNS(suiteContext, baseName, c, labels, NewTimeouts())
+}
+
+func createTestingNS(ctx context.Context, baseName string, c clientset.Interface, labels map[string]string, timeouts *Timeouts) (*v1.Namespace, error) {
 	if labels == nil {
 		labels = make(map[string]string)
 	}
 
-	labels["e2e-run"] = string(RunId)
+	labels[RunLabel] = string(RunId)
 
 	namespaceObj := &v1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
@@ -88,11 +155,11 @@ func CreateTestingNS(baseName string, c clientset.Interface, labels map[string]s
 
 	var got *v1.Namespace
 
-	if err := wait.PollImmediate(Poll, 30*time.Second, func() (bool, error) {
+	if err := pollImmediate(ctx, timeouts.Poll, timeouts.NamespaceCreate, func() (bool, error) {
 		var err error
 		got, err = c.CoreV1().Namespaces().Create(namespaceObj)
 		if err != nil {
-			glog.Warningf("unexpected error when creating namespace: %v\n", err)
+			e2elog.Warnf("unexpected error when creating namespace: %v", err)
 			return false, nil
 		}
 		return true, nil
@@ -100,20 +167,24 @@ func CreateTestingNS(baseName string, c clientset.Interface, labels map[string]s
 		return nil, err
 	}
 
-	if err := WaitForDefaultServiceAccountInNamespace(c, got.Name); err != nil {
+	if err := waitForServiceAccountInNamespace(ctx, c, got.Name, "default", timeouts.ServiceAccountProvision); err != nil {
 		return nil, err
 	}
+	// the namespace is returned, so it is deleted
+	if err := createPullSecret(c, got.Name); err != nil {
+		return got, err
+	}
 	return got, nil
 }
 
-func deleteNS(c clientset.Interface, dynamicClient dynamic.Interface, namespace string, timeout time.Duration) error {
+func deleteNS(ctx context.Context, c clientset.Interface, dynamicClient dynamic.Interface, namespace string, timeouts *Timeouts) error {
 	startTime := time.Now()
 
 	if err := c.CoreV1().Namespaces().Delete(namespace, nil); err != nil {
 		return err
 	}
 
-	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+	err := pollImmediate(ctx, timeouts.Poll, timeouts.NamespaceDelete, func() (bool, error) {
 		if _, err := c.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{}); err != nil {
 			if apierrs.IsNotFound(err) {
 				return true, nil
@@ -126,7 +197,7 @@ func deleteNS(c clientset.Interface, dynamicClient dynamic.Interface, namespace
 	})
 
 	// verify there is no more remaining content in the namespace
-	remainingContent, cerr := hasRemainingContent(c, dynamicClient, namespace)
+	remainingContent, cerr := hasRemainingContent(ctx, c, dynamicClient, namespace, timeouts)
 	if cerr != nil {
 		return cerr
 	}
@@ -168,23 +239,32 @@ func deleteNS(c clientset.Interface, dynamicClient dynamic.Interface, namespace
 }
 
 func WaitForDefaultServiceAccountInNamespace(c clientset.Interface, namespace string) error {
-	return waitForServiceAccountInNamespace(c, namespace, "default", ServiceAccountProvisionTimeout)
+	return waitForServiceAccountInNamespace(suiteContext, c, namespace, "default", timeouts.ServiceAccountProvision)
 }
 
-func waitForServiceAccountInNamespace(c clientset.Interface, namespace, accountName string, timeout time.Duration) error {
+// WaitForServiceAccount waits for a service account to get its token secret,
+// pods using it are rejected until then.
+func (f *Framework) WaitForServiceAccount(namespace, name string) error {
+	if err := waitForServiceAccountInNamespace(f.Context(), f.ClientSet, namespace, name, f.Timeouts.ServiceAccountProvision); err != nil {
+		return fmt.Errorf("error waiting for the token of service account %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+func waitForServiceAccountInNamespace(ctx context.Context, c clientset.Interface, namespace, accountName string, timeout time.Duration) error {
 	w, err := c.CoreV1().ServiceAccounts(namespace).Watch(metav1.SingleObject(metav1.ObjectMeta{Name: accountName}))
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := watchtools.ContextWithOptionalTimeout(context.Background(), timeout)
+	ctx, cancel := watchtools.ContextWithOptionalTimeout(ctx, timeout)
 	defer cancel()
 	_, err = watchtools.UntilWithoutRetry(ctx, w, conditions.ServiceAccountHasSecrets)
 	return err
 }
 
 // hasRemainingContent checks if there is remaining content in the namespace via API discovery
-func hasRemainingContent(c clientset.Interface, dynamicClient dynamic.Interface, namespace string) (bool, error) {
+func hasRemainingContent(ctx context.Context, c clientset.Interface, dynamicClient dynamic.Interface, namespace string, timeouts *Timeouts) (bool, error) {
 	// some tests generate their own framework.Client rather than the default
 	// TODO: ensure every test call has a configured dynamicClient
 	if dynamicClient == nil {
@@ -194,7 +274,7 @@ func hasRemainingContent(c clientset.Interface, dynamicClient dynamic.Interface,
 	// find out what content is supported on the server
 	// Since extension apiserver is not always available, e.g. metrics server sometimes goes down,
 	// add retry here.
-	resources, err := waitForServerPreferredNamespacedResources(c.Discovery(), 30*time.Second)
+	resources, err := waitForServerPreferredNamespacedResources(ctx, c.Discovery(), timeouts.Poll, timeouts.ServerResources)
 	if err != nil {
 		return false, err
 	}
@@ -246,10 +326,10 @@ func hasRemainingContent(c clientset.Interface, dynamicClient dynamic.Interface,
 
 // waitForServerPreferredNamespacedResources waits until server preferred namespaced resources could be successfully discovered.
 // TODO: Fix https://github.com/kubernetes/kubernetes/issues/55768 and remove the following retry.
-func waitForServerPreferredNamespacedResources(d discovery.DiscoveryInterface, timeout time.Duration) ([]*metav1.APIResourceList, error) {
+func waitForServerPreferredNamespacedResources(ctx context.Context, d discovery.DiscoveryInterface, poll, timeout time.Duration) ([]*metav1.APIResourceList, error) {
 	Logf("Waiting up to %v for server preferred namespaced resources to be successfully discovered", timeout)
 	var resources []*metav1.APIResourceList
-	if err := wait.PollImmediate(Poll, timeout, func() (bool, error) {
+	if err := pollImmediate(ctx, poll, timeout, func() (bool, error) {
 		var err error
 		resources, err = d.ServerPreferredNamespacedResources()
 		if err == nil {
@@ -258,7 +338,7 @@ func waitForServerPreferredNamespacedResources(d discovery.DiscoveryInterface, t
 		if !discovery.IsGroupDiscoveryFailedError(err) {
 			return false, err
 		}
-		Logf("Error discoverying server preferred namespaced resources: %v, retrying in %v.", err, Poll)
+		Logf("Error discoverying server preferred namespaced resources: %v, retrying in %v.", err, poll)
 		return false, nil
 	}); err != nil {
 		return nil, err
@@ -266,16 +346,14 @@ func waitForServerPreferredNamespacedResources(d discovery.DiscoveryInterface, t
 	return resources, nil
 }
 
-func log(level string, format string, args ...interface{}) {
-	fmt.Fprintf(GinkgoWriter, nowStamp()+": "+level+": "+format+"\n", args...)
-}
-
+// Logf logs the info through the framework log package.
 func Logf(format string, args ...interface{}) {
-	log("INFO", format, args...)
+	e2elog.Logf(format, args...)
 }
 
-func nowStamp() string {
-	return time.Now().Format(time.StampMilli)
+// Failf logs the fail info and fails the current spec at the caller of Failf.
+func Failf(format string, args ...interface{}) {
+	e2elog.FailfWithOffset(1, format, args...)
 }
 
 // logNamespace logs detail about a namespace
@@ -375,3 +453,49 @@ func logPodStates(pods []v1.Pod) {
 	}
 	Logf("") // Final empty line helps for readability.
 }
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// maxFileNameLength is the length of the file names of SanitizeFileName.
+const maxFileNameLength = 200
+
+// SanitizeFileName turns a spec text into something usable as a file name.
+// Long names are truncated, with a hash of the whole name appended, so specs
+// sharing a long prefix get their own files.
+func SanitizeFileName(name string) string {
+	sanitized := strings.Trim(unsafeFileNameChars.ReplaceAllString(name, "_"), "_")
+	if len(sanitized) > maxFileNameLength {
+		hash := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(name)))
+		sanitized = sanitized[:maxFileNameLength-len(hash)-1] + "_" + hash
+	}
+	return sanitized
+}
+
+// DumpNamespaceInfo writes the events and pods of a namespace into dir, so they
+// survive the namespace deletion.
+func DumpNamespaceInfo(c clientset.Interface, namespace, dir string) error {
+	events, err := c.CoreV1().Events(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing events in namespace %s: %v", namespace, err)
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+	})
+	var lines []string
+	for _, e := range events.Items {
+		lines = append(lines, fmt.Sprintf("%v %s %s/%s %s: %s", e.LastTimestamp, e.Type, e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Reason, e.Message))
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, namespace+"-events.log"), redact.Bytes([]byte(strings.Join(lines, "\n")+"\n")), 0644); err != nil {
+		return err
+	}
+
+	pods, err := c.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing pods in namespace %s: %v", namespace, err)
+	}
+	data, err := json.MarshalIndent(pods, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, namespace+"-pods.json"), redact.JSON(data), 0644)
+}
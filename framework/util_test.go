@@ -0,0 +1,34 @@
+package framework
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	prefix := strings.Repeat("volumes should keep the data of a claim ", 10)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "volumes [Slow] mounts a volume", want: "volumes_Slow_mounts_a_volume"},
+		{name: "  a/b\\c: d ", want: "a_b_c_d"},
+		{name: strings.Repeat("a", 200), want: strings.Repeat("a", 200)},
+	}
+	for _, test := range tests {
+		if got := SanitizeFileName(test.name); got != test.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	first, second := SanitizeFileName(prefix+"after a restart"), SanitizeFileName(prefix+"after a deletion")
+	if len(first) != maxFileNameLength || len(second) != maxFileNameLength {
+		t.Errorf("SanitizeFileName() of long names = %d and %d characters, want %d", len(first), len(second), maxFileNameLength)
+	}
+	if first == second {
+		t.Errorf("SanitizeFileName() of long names sharing a prefix = %q for both", first)
+	}
+	if first != SanitizeFileName(prefix+"after a restart") {
+		t.Errorf("SanitizeFileName() of a long name isn't stable")
+	}
+}
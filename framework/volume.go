@@ -0,0 +1,469 @@
+package framework
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zryfish/framework/framework/image"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HostPathStorageClass is the storage class, given to --storage-class, of the
+// hostPath volumes the framework creates itself, on local clusters without a
+// provisioner. The class doesn't have to exist, the volumes are bound to their
+// claims when created.
+const HostPathStorageClass = "e2e-hostpath"
+
+const (
+	// defaultVolumeSize is the size of the claims without a size.
+	defaultVolumeSize = "1Gi"
+	// hostPathVolumeDir is the directory of the hostPath volumes on the nodes.
+	hostPathVolumeDir = "/tmp"
+	// volumeContainer is the container of the pods of the volume testers.
+	volumeContainer = "volume"
+	// volumeMountPath is where the volume testers mount the claim.
+	volumeMountPath = "/mnt/volume"
+)
+
+// StorageClass returns the storage class of the claims created by the
+// framework: --storage-class, then the storage class of the provider, "" for
+// the cluster default.
+func StorageClass() string {
+	if TestContext.StorageClass != "" {
+		return TestContext.StorageClass
+	}
+	return Provider().DefaultStorageClass()
+}
+
+// VolumeOptions describe a persistent volume claim.
+type VolumeOptions struct {
+	Name string
+	// Size defaults to 1Gi.
+	Size string
+	// StorageClass defaults to StorageClass().
+	StorageClass string
+	// AccessMode defaults to ReadWriteOnce.
+	AccessMode v1.PersistentVolumeAccessMode
+	// NodeName is the node of a hostPath volume, it defaults to the first
+	// schedulable node. It is ignored for the other storage classes.
+	NodeName string
+}
+
+// CreateVolume creates a persistent volume claim in the framework namespace,
+// and its hostPath volume for HostPathStorageClass. It doesn't wait for the
+// claim to be bound, the volumes of WaitForFirstConsumer storage classes are
+// only provisioned once a pod uses the claim, see WaitForClaimBound.
+func (f *Framework) CreateVolume(options VolumeOptions) (*v1.PersistentVolumeClaim, error) {
+	if options.Size == "" {
+		options.Size = defaultVolumeSize
+	}
+	if options.StorageClass == "" {
+		options.StorageClass = StorageClass()
+	}
+	if options.AccessMode == "" {
+		options.AccessMode = v1.ReadWriteOnce
+	}
+	size, err := resource.ParseQuantity(options.Size)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the size of claim %s: %v", options.Name, err)
+	}
+
+	namespace := f.Namespace.Name
+	claim := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: options.Name},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{options.AccessMode},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: size},
+			},
+		},
+	}
+	if options.StorageClass != "" {
+		claim.Spec.StorageClassName = &options.StorageClass
+	}
+	if options.StorageClass == HostPathStorageClass {
+		pv, err := f.createHostPathVolume(options, size)
+		if err != nil {
+			return nil, err
+		}
+		claim.Spec.VolumeName = pv.Name
+	}
+	claim, err = f.ClientSet.CoreV1().PersistentVolumeClaims(namespace).Create(claim)
+	if err != nil {
+		return nil, fmt.Errorf("error creating claim %s/%s: %v", namespace, options.Name, err)
+	}
+	Logf("Created claim %s/%s of %s, storage class %q", namespace, claim.Name, options.Size, options.StorageClass)
+	return claim, nil
+}
+
+// createHostPathVolume creates a hostPath volume on a node, bound to the claim
+// of options. It is deleted in AfterEach, and its directory too if the provider
+// can run commands on the nodes.
+func (f *Framework) createHostPathVolume(options VolumeOptions, size resource.Quantity) (*v1.PersistentVolume, error) {
+	node, err := f.hostPathVolumeNode(options.NodeName)
+	if err != nil {
+		return nil, err
+	}
+	namespace := f.Namespace.Name
+	name := fmt.Sprintf("e2e-%s-%s", namespace, options.Name)
+	directory := path.Join(hostPathVolumeDir, name)
+	directoryOrCreate := v1.HostPathDirectoryOrCreate
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: f.StandardLabels(),
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity:                      v1.ResourceList{v1.ResourceStorage: size},
+			AccessModes:                   []v1.PersistentVolumeAccessMode{options.AccessMode},
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimRetain,
+			StorageClassName:              HostPathStorageClass,
+			ClaimRef: &v1.ObjectReference{
+				Namespace: namespace,
+				Name:      options.Name,
+			},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				HostPath: &v1.HostPathVolumeSource{Path: directory, Type: &directoryOrCreate},
+			},
+			// the data is on the node
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{{
+							Key:      v1.LabelHostname,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{node.Labels[v1.LabelHostname]},
+						}},
+					}},
+				},
+			},
+		},
+	}
+	pv, err = f.ClientSet.CoreV1().PersistentVolumes().Create(pv)
+	if err != nil {
+		return nil, fmt.Errorf("error creating hostPath volume %s: %v", name, err)
+	}
+	f.AddCleanup(func() error {
+		if err := f.ClientSet.CoreV1().PersistentVolumes().Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting hostPath volume %s: %v", name, err)
+		}
+		if HasCapability(CapabilityNodeAccess) {
+			if _, err := Provider().ExecOnNode(node.Name, "rm -rf "+shellQuote(directory)); err != nil {
+				return fmt.Errorf("error deleting the directory of hostPath volume %s: %v", name, err)
+			}
+		}
+		return nil
+	})
+	Logf("Created hostPath volume %s in %s on node %s", name, directory, node.Name)
+	return pv, nil
+}
+
+// hostPathVolumeNode returns the node of a hostPath volume, the named node or
+// the first schedulable node by name.
+func (f *Framework) hostPathVolumeNode(nodeName string) (*v1.Node, error) {
+	if nodeName != "" {
+		node, err := f.ClientSet.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting node %s: %v", nodeName, err)
+		}
+		return node, nil
+	}
+	nodes, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %v", err)
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool { return nodes.Items[i].Name < nodes.Items[j].Name })
+	for i := range nodes.Items {
+		if isNodeSchedulable(&nodes.Items[i]) {
+			return &nodes.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no schedulable node for a hostPath volume among %d nodes", len(nodes.Items))
+}
+
+// WaitForClaimBound waits for a claim of the framework namespace to be bound to a volume.
+func (f *Framework) WaitForClaimBound(claimName string) (*v1.PersistentVolumeClaim, error) {
+	namespace := f.Namespace.Name
+	var claim *v1.PersistentVolumeClaim
+	err := f.WaitUntil(f.Timeouts.ClaimBound, func() (bool, error) {
+		var err error
+		claim, err = f.ClientSet.CoreV1().PersistentVolumeClaims(namespace).Get(claimName, metav1.GetOptions{})
+		if err != nil {
+			Logf("Failed to get claim %s/%s, retrying in %v: %v", namespace, claimName, f.Timeouts.Poll, err)
+			return false, nil
+		}
+		switch claim.Status.Phase {
+		case v1.ClaimLost:
+			return false, fmt.Errorf("claim %s/%s lost its volume %s", namespace, claimName, claim.Spec.VolumeName)
+		case v1.ClaimBound:
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return claim, fmt.Errorf("error waiting for claim %s/%s to be bound: %v", namespace, claimName, err)
+	}
+	return claim, nil
+}
+
+// VolumeTester checks the integrity of the data of a claim: it writes files
+// from a writer pod mounting the claim, and verifies their checksums after the
+// writer pod is restarted or rescheduled, and from reader pods.
+type VolumeTester struct {
+	f         *Framework
+	claimName string
+
+	// pod is the writer pod, named after the claim and a counter, so a pod
+	// isn't recreated under the name of a pod being deleted.
+	pod       *v1.Pod
+	pods      int
+	checksums map[string]string
+}
+
+// NewVolumeTester starts a writer pod mounting a claim of the framework
+// namespace, and waits for the claim to be bound.
+func (f *Framework) NewVolumeTester(claimName string) (*VolumeTester, error) {
+	t := &VolumeTester{
+		f:         f,
+		claimName: claimName,
+		checksums: map[string]string{},
+	}
+	pod, err := t.startPod("writer", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.pod = pod
+	if _, err := f.WaitForClaimBound(claimName); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// PodName returns the name of the writer pod.
+func (t *VolumeTester) PodName() string {
+	return t.pod.Name
+}
+
+// NodeName returns the node of the writer pod.
+func (t *VolumeTester) NodeName() string {
+	return t.pod.Spec.NodeName
+}
+
+// WriteFile writes size random bytes to a file of the volume, syncs it, and
+// records its checksum. name is relative to the root of the volume, its
+// directory must exist.
+func (t *VolumeTester) WriteFile(name string, size int64) error {
+	file := path.Join(volumeMountPath, name)
+	r, err := t.f.ExecShellInContainer(t.pod.Name, volumeContainer, fmt.Sprintf("head -c %d /dev/urandom > %s && sync && sha256sum %s", size, shellQuote(file), shellQuote(file)))
+	if err := execSucceeded(r, err); err != nil {
+		return fmt.Errorf("error writing %s to claim %s from pod %s: %v", name, t.claimName, t.pod.Name, err)
+	}
+	fields := strings.Fields(r.Stdout)
+	if len(fields) == 0 {
+		return fmt.Errorf("error writing %s to claim %s from pod %s: no checksum in %q", name, t.claimName, t.pod.Name, r.Stdout)
+	}
+	t.checksums[name] = fields[0]
+	return nil
+}
+
+// Verify verifies the checksums of the written files from the writer pod.
+func (t *VolumeTester) Verify() error {
+	return t.verify(t.pod.Name)
+}
+
+// VerifyFromReader starts a pod mounting the claim read-only, on the node of
+// the writer pod so ReadWriteOnce volumes can be mounted, verifies the
+// checksums of the written files from it, and deletes it.
+func (t *VolumeTester) VerifyFromReader() error {
+	reader, err := t.startPod("reader", true, func(spec *v1.PodSpec) {
+		spec.NodeName = t.NodeName()
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := t.deletePod(reader.Name); err != nil {
+			Logf("Failed to delete reader pod %s: %v", reader.Name, err)
+		}
+	}()
+	return t.verify(reader.Name)
+}
+
+// RestartPod deletes the writer pod and recreates it on the same node.
+func (t *VolumeTester) RestartPod() error {
+	node := t.NodeName()
+	return t.replacePod(func(spec *v1.PodSpec) {
+		spec.NodeName = node
+	})
+}
+
+// ReschedulePod deletes the writer pod and recreates it on another node, the
+// volume has to be detached and attached again. It fails for volumes bound to
+// a node, e.g. hostPath and local volumes.
+func (t *VolumeTester) ReschedulePod() error {
+	claim, err := t.f.ClientSet.CoreV1().PersistentVolumeClaims(t.f.Namespace.Name).Get(t.claimName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting claim %s: %v", t.claimName, err)
+	}
+	pv, err := t.f.ClientSet.CoreV1().PersistentVolumes().Get(claim.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting volume %s of claim %s: %v", claim.Spec.VolumeName, t.claimName, err)
+	}
+	if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+		return fmt.Errorf("volume %s of claim %s is bound to nodes, its pods can't be rescheduled", pv.Name, t.claimName)
+	}
+	node, err := t.f.ClientSet.CoreV1().Nodes().Get(t.NodeName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting node %s: %v", t.NodeName(), err)
+	}
+	hostname := node.Labels[v1.LabelHostname]
+	return t.replacePod(func(spec *v1.PodSpec) {
+		spec.Affinity = &v1.Affinity{
+			NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{{
+							Key:      v1.LabelHostname,
+							Operator: v1.NodeSelectorOpNotIn,
+							Values:   []string{hostname},
+						}},
+					}},
+				},
+			},
+		}
+	})
+}
+
+// replacePod deletes the writer pod, waits for it to be gone so the volume is
+// unmounted, and starts a new writer pod.
+func (t *VolumeTester) replacePod(customize func(spec *v1.PodSpec)) error {
+	previous := t.pod
+	if err := t.deletePod(previous.Name); err != nil {
+		return err
+	}
+	pod, err := t.startPod("writer", false, customize)
+	if err != nil {
+		return err
+	}
+	t.pod = pod
+	Logf("Replaced writer pod %s on node %s by pod %s on node %s", previous.Name, previous.Spec.NodeName, pod.Name, pod.Spec.NodeName)
+	return nil
+}
+
+// startPod starts a pod mounting the claim and waits for it to be running.
+func (t *VolumeTester) startPod(role string, readOnly bool, customize func(spec *v1.PodSpec)) (*v1.Pod, error) {
+	t.pods++
+	name := fmt.Sprintf("%s-%s-%d", t.claimName, role, t.pods)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  volumeContainer,
+				Image: image.Get(image.Busybox),
+				// exits on SIGTERM, so the pod is deleted without waiting for the grace period
+				Command: []string{"/bin/sh", "-c", "trap 'exit 0' TERM; while true; do sleep 1; done"},
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      "data",
+					MountPath: volumeMountPath,
+					ReadOnly:  readOnly,
+				}},
+			}},
+			Volumes: []v1.Volume{{
+				Name: "data",
+				VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+						ClaimName: t.claimName,
+						ReadOnly:  readOnly,
+					},
+				},
+			}},
+		},
+	}
+	if customize != nil {
+		customize(&pod.Spec)
+	}
+	t.f.MutatePodSpec(&pod.Spec)
+	if _, err := t.f.ClientSet.CoreV1().Pods(t.f.Namespace.Name).Create(pod); err != nil {
+		return nil, fmt.Errorf("error creating %s pod %s of claim %s: %v", role, name, t.claimName, err)
+	}
+	return t.f.WaitForPodRunning(name)
+}
+
+// deletePod deletes a pod and waits for it to be gone.
+func (t *VolumeTester) deletePod(name string) error {
+	pods := t.f.ClientSet.CoreV1().Pods(t.f.Namespace.Name)
+	if err := pods.Delete(name, &metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("error deleting pod %s: %v", name, err)
+	}
+	err := t.f.WaitUntil(t.f.Timeouts.PodStart, func() (bool, error) {
+		_, err := pods.Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			Logf("Failed to get pod %s, retrying in %v: %v", name, t.f.Timeouts.Poll, err)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for pod %s to be deleted: %v", name, err)
+	}
+	return nil
+}
+
+// verify compares the checksums of the written files, computed in a pod, to
+// the recorded ones.
+func (t *VolumeTester) verify(podName string) error {
+	if len(t.checksums) == 0 {
+		return fmt.Errorf("no files written to claim %s", t.claimName)
+	}
+	var names []string
+	for name := range t.checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	command := "cd " + volumeMountPath + " && sha256sum"
+	for _, name := range names {
+		command += " " + shellQuote(name)
+	}
+	// missing files make sha256sum fail, they are reported below
+	r, err := t.f.ExecShellInContainer(podName, volumeContainer, command)
+	if err != nil {
+		return fmt.Errorf("error verifying claim %s from pod %s: %v", t.claimName, podName, err)
+	}
+	observed := map[string]string{}
+	for _, line := range strings.Split(r.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			observed[fields[1]] = fields[0]
+		}
+	}
+	var mismatches []string
+	for _, name := range names {
+		switch sum, ok := observed[name]; {
+		case !ok:
+			mismatches = append(mismatches, name+" is missing")
+		case sum != t.checksums[name]:
+			mismatches = append(mismatches, fmt.Sprintf("%s has checksum %s, wrote %s", name, sum, t.checksums[name]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("data of claim %s corrupted, seen from pod %s on node %s: %s", t.claimName, podName, t.nodeOf(podName), strings.Join(mismatches, ", "))
+	}
+	Logf("Verified %d files of claim %s from pod %s", len(names), t.claimName, podName)
+	return nil
+}
+
+// nodeOf returns the node of a pod of the tester, for the errors.
+func (t *VolumeTester) nodeOf(podName string) string {
+	pod, err := t.f.ClientSet.CoreV1().Pods(t.f.Namespace.Name).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return "unknown"
+	}
+	return pod.Spec.NodeName
+}
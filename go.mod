@@ -33,5 +33,7 @@ require (
 	k8s.io/api v0.0.0
 	k8s.io/apimachinery v0.0.0
 	k8s.io/client-go v0.0.0
+	k8s.io/klog v0.3.1
 	k8s.io/kubernetes v0.0.0-00010101000000-000000000000
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zryfish/framework/framework/history"
+	"github.com/zryfish/framework/framework/junit"
+)
+
+func historyCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected an action: ingest or compare")
+	}
+
+	switch args[0] {
+	case "ingest":
+		return historyIngest(args[1:])
+	case "compare":
+		return historyCompare(args[1:])
+	default:
+		return fmt.Errorf("unknown action %q, expected ingest or compare", args[0])
+	}
+}
+
+// historyFlags registers the flags shared by the history actions.
+func historyFlags(fs *flag.FlagSet) (store, reportDir, reportPrefix *string) {
+	store = fs.String("store", "e2e-history.jsonl", "Path of the history store, one JSON record per line.")
+	reportDir = fs.String("report-dir", "reports", "Directory containing the JSON or JUnit reports of the run.")
+	reportPrefix = fs.String("report-prefix", "service", "File name prefix of the reports.")
+	return
+}
+
+func historyIngest(args []string) error {
+	fs := flag.NewFlagSet("history ingest", flag.ExitOnError)
+	storePath, reportDir, reportPrefix := historyFlags(fs)
+	fs.Parse(args)
+
+	suite, err := junit.ReadRun(*reportDir, *reportPrefix)
+	if err != nil {
+		return err
+	}
+	records := history.FromSuite(suite)
+	if len(records) == 0 {
+		return fmt.Errorf("no spec results found in %s", *reportDir)
+	}
+
+	store := history.NewStore(*storePath)
+	ingested, err := store.HasRun(records[0].RunId)
+	if err != nil {
+		return err
+	}
+	if ingested {
+		return fmt.Errorf("run %s is already in %s", records[0].RunId, *storePath)
+	}
+	if err := store.Append(records); err != nil {
+		return err
+	}
+	fmt.Printf("Ingested %d results of run %s into %s\n", len(records), records[0].RunId, *storePath)
+	return nil
+}
+
+func historyCompare(args []string) error {
+	fs := flag.NewFlagSet("history compare", flag.ExitOnError)
+	storePath, reportDir, reportPrefix := historyFlags(fs)
+	threshold := fs.Float64("threshold", 0.5, "Relative duration increase over the baseline reported as a regression, 0.5 is 50% slower.")
+	minDelta := fs.Duration("min-delta", 5*time.Second, "Minimum absolute duration increase reported as a regression.")
+	fail := fs.Bool("fail", false, "Exit with an error when new failures or duration regressions are found.")
+	fs.Parse(args)
+
+	suite, err := junit.ReadRun(*reportDir, *reportPrefix)
+	if err != nil {
+		return err
+	}
+	past, err := history.NewStore(*storePath).Load()
+	if err != nil {
+		return err
+	}
+
+	c := history.Compare(past, history.FromSuite(suite), *threshold, minDelta.Seconds())
+	printComparison(c)
+
+	if *fail && (len(c.NewFailures) > 0 || len(c.Regressions) > 0) {
+		return fmt.Errorf("%d new failures, %d duration regressions", len(c.NewFailures), len(c.Regressions))
+	}
+	return nil
+}
+
+func printComparison(c *history.Comparison) {
+	if c.Empty() {
+		fmt.Println("No new failures, fixed specs or duration regressions.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if len(c.NewFailures) > 0 {
+		fmt.Fprintf(w, "NEW FAILURES (%d)\n", len(c.NewFailures))
+		for _, r := range c.NewFailures {
+			fmt.Fprintf(w, "  %s\n", r.Spec)
+		}
+	}
+	if len(c.Fixed) > 0 {
+		fmt.Fprintf(w, "FIXED (%d)\n", len(c.Fixed))
+		for _, r := range c.Fixed {
+			fmt.Fprintf(w, "  %s\n", r.Spec)
+		}
+	}
+	if len(c.Regressions) > 0 {
+		fmt.Fprintf(w, "DURATION REGRESSIONS (%d)\n", len(c.Regressions))
+		fmt.Fprintf(w, "  SPEC\tBASELINE\tDURATION\tCHANGE\n")
+		for _, r := range c.Regressions {
+			change := "n/a"
+			if r.Baseline > 0 {
+				change = fmt.Sprintf("+%.0f%%", (r.Duration/r.Baseline-1)*100)
+			}
+			fmt.Fprintf(w, "  %s\t%.3fs\t%.3fs\t%s\n", r.Spec, r.Baseline, r.Duration, change)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/zryfish/framework/framework/junit"
+)
+
+// propertyFlags collects repeated --property name=value flags.
+type propertyFlags []junit.Property
+
+func (p *propertyFlags) String() string {
+	var s []string
+	for _, property := range *p {
+		s = append(s, property.Name+"="+property.Value)
+	}
+	return strings.Join(s, ",")
+}
+
+func (p *propertyFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("property %q is not of the form name=value", value)
+	}
+	*p = append(*p, junit.Property{Name: parts[0], Value: parts[1]})
+	return nil
+}
+
+func mergeJUnit(args []string) error {
+	fs := flag.NewFlagSet("merge-junit", flag.ExitOnError)
+	reportDir := fs.String("report-dir", "reports", "Directory containing the per-node JUnit reports.")
+	reportPrefix := fs.String("report-prefix", "service", "File name prefix of the per-node JUnit reports.")
+	output := fs.String("output", "", "Path of the merged report. Defaults to <report-dir>/<report-prefix>.xml.")
+	name := fs.String("name", "", "Name of the merged test suite. Defaults to the name found in the node reports.")
+	var properties propertyFlags
+	fs.Var(&properties, "property", "Extra name=value property to add to the merged report, may be repeated.")
+	fs.Parse(args)
+
+	files, err := junit.FindNodeReports(*reportDir, *reportPrefix)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no reports matching %s_<node>.xml found in %s", *reportPrefix, *reportDir)
+	}
+
+	if *output == "" {
+		*output = junit.MergedReportFile(*reportDir, *reportPrefix)
+	}
+	if err := junit.MergeFiles(*output, *name, files, properties); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d reports into %s\n", len(files), *output)
+	return nil
+}